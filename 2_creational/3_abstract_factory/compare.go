@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Spec field read from a family's car details
+type specField struct {
+	name  string
+	value func(ICarDetails) string
+}
+
+// New fields added to ICarDetails get a row in the matrix by being listed here
+var specFields = []specField{
+	{name: "Transmission", value: ICarDetails.getTransmission},
+	{name: "Engine", value: ICarDetails.getEngine},
+	{name: "Gas Type", value: ICarDetails.getGasType},
+	{name: "Fuel Consumption", value: func(d ICarDetails) string {
+		return fmt.Sprintf("%.1f L/100km", d.getFuelConsumption())
+	}},
+	{name: "Electric Consumption", value: func(d ICarDetails) string {
+		return fmt.Sprintf("%.1f kWh/100km", d.getElectricConsumption())
+	}},
+	{name: "Price", value: func(d ICarDetails) string {
+		return fmt.Sprintf("%.2f", d.getPrice())
+	}},
+}
+
+type specRow struct {
+	name    string
+	values  []string
+	differs bool
+}
+
+// Spec matrix: one column per factory family, one row per spec field
+type SpecMatrix struct {
+	families []string
+	rows     []specRow
+}
+
+func newSpecMatrix(factories ...ICarFactory) (*SpecMatrix, error) {
+	if len(factories) < 2 {
+		return nil, errors.New("at least two car factories are needed for a comparison")
+	}
+
+	matrix := &SpecMatrix{}
+	details := make([]ICarDetails, 0, len(factories))
+	for _, factory := range factories {
+		if factory == nil {
+			return nil, errors.New("cannot compare a nil car factory")
+		}
+		car, carDetails := factory.makeCar(), factory.makeCarDetails()
+		if car == nil || carDetails == nil {
+			return nil, errors.New("car factory did not make a car and its details")
+		}
+		matrix.families = append(matrix.families, car.getCarType())
+		details = append(details, carDetails)
+	}
+
+	for _, field := range specFields {
+		row := specRow{name: field.name}
+		for _, d := range details {
+			value := field.value(d)
+			if len(row.values) > 0 && value != row.values[0] {
+				row.differs = true
+			}
+			row.values = append(row.values, value)
+		}
+		matrix.rows = append(matrix.rows, row)
+	}
+
+	return matrix, nil
+}
+
+// Terminal table, differing rows are marked with an asterisk
+func (m *SpecMatrix) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  Spec\t%s\n", strings.Join(m.families, "\t"))
+	for _, row := range m.rows {
+		marker := " "
+		if row.differs {
+			marker = "*"
+		}
+		fmt.Fprintf(tw, "%s %s\t%s\n", marker, row.name, strings.Join(row.values, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w, "* values differ between families")
+	return err
+}
+
+// Markdown table, differing values are in bold
+func (m *SpecMatrix) writeMarkdown(w io.Writer) error {
+	fmt.Fprintf(w, "| Spec | %s |\n", strings.Join(m.families, " | "))
+	fmt.Fprintf(w, "|---%s|\n", strings.Repeat("|---", len(m.families)))
+	for _, row := range m.rows {
+		values := row.values
+		if row.differs {
+			values = make([]string, len(row.values))
+			for i, value := range row.values {
+				values[i] = "**" + value + "**"
+			}
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s |\n", row.name, strings.Join(values, " | ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSV with a trailing column flagging differing rows
+func (m *SpecMatrix) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append([]string{"Spec"}, m.families...)
+	if err := cw.Write(append(header, "Differs")); err != nil {
+		return err
+	}
+	for _, row := range m.rows {
+		record := append([]string{row.name}, row.values...)
+		if err := cw.Write(append(record, fmt.Sprint(row.differs))); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
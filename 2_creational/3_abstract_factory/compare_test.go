@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Two families that differ in engine, fuel use and price only
+func testSpecMatrix(t *testing.T) *SpecMatrix {
+	t.Helper()
+	city := newFakeCarFactory().
+		withCars(&Car{carType: "City"}).
+		withCarDetails(&CarDetails{transmission: "manual", engine: "gas", gasType: "gas", fuelConsumption: 5, price: 15000})
+	van := newFakeCarFactory().
+		withCars(&Car{carType: "Van"}).
+		withCarDetails(&CarDetails{transmission: "manual", engine: "diesel", gasType: "gas", fuelConsumption: 8.5, price: 32000.5})
+
+	matrix, err := newSpecMatrix(city, van)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matrix
+}
+
+func TestSpecRowDiffers(t *testing.T) {
+	matrix := testSpecMatrix(t)
+	want := map[string]bool{
+		"Transmission":         false,
+		"Engine":               true,
+		"Gas Type":             false,
+		"Fuel Consumption":     true,
+		"Electric Consumption": false,
+		"Price":                true,
+	}
+	if len(matrix.rows) != len(want) {
+		t.Fatalf("%d rows, want %d", len(matrix.rows), len(want))
+	}
+	for _, row := range matrix.rows {
+		if row.differs != want[row.name] {
+			t.Errorf("%s: differs = %v, want %v", row.name, row.differs, want[row.name])
+		}
+	}
+}
+
+func TestSpecMatrixOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*SpecMatrix, *strings.Builder) error
+		want  string
+	}{
+		{
+			name:  "table",
+			write: func(m *SpecMatrix, b *strings.Builder) error { return m.writeTable(b) },
+			want: `  Spec                  City           Van
+  Transmission          manual         manual
+* Engine                gas            diesel
+  Gas Type              gas            gas
+* Fuel Consumption      5.0 L/100km    8.5 L/100km
+  Electric Consumption  0.0 kWh/100km  0.0 kWh/100km
+* Price                 15000.00       32000.50
+* values differ between families
+`,
+		},
+		{
+			name:  "markdown",
+			write: func(m *SpecMatrix, b *strings.Builder) error { return m.writeMarkdown(b) },
+			want: `| Spec | City | Van |
+|---|---|---|
+| Transmission | manual | manual |
+| Engine | **gas** | **diesel** |
+| Gas Type | gas | gas |
+| Fuel Consumption | **5.0 L/100km** | **8.5 L/100km** |
+| Electric Consumption | 0.0 kWh/100km | 0.0 kWh/100km |
+| Price | **15000.00** | **32000.50** |
+`,
+		},
+		{
+			name:  "csv",
+			write: func(m *SpecMatrix, b *strings.Builder) error { return m.writeCSV(b) },
+			want: `Spec,City,Van,Differs
+Transmission,manual,manual,false
+Engine,gas,diesel,true
+Gas Type,gas,gas,false
+Fuel Consumption,5.0 L/100km,8.5 L/100km,true
+Electric Consumption,0.0 kWh/100km,0.0 kWh/100km,false
+Price,15000.00,32000.50,true
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := tt.write(testSpecMatrix(t), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecMatrixNeedsTwoFactories(t *testing.T) {
+	if _, err := newSpecMatrix(&LuxuryCarFactory{}); err == nil {
+		t.Error("newSpecMatrix accepted a single factory")
+	}
+	if _, err := newSpecMatrix(&LuxuryCarFactory{}, nil); err == nil {
+		t.Error("newSpecMatrix accepted a nil factory")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	methodMakeCar        = "makeCar"
+	methodMakeCarDetails = "makeCarDetails"
+)
+
+// Recording fake factory family for testing ICarFactory consumers.
+// Scripted products are returned in order, the last one repeating once the script runs out.
+// A failed call returns nil, the same way getCarFactory reports an unknown family.
+type FakeCarFactory struct {
+	mu       sync.Mutex
+	cars     []ICar
+	details  []ICarDetails
+	calls    []string
+	counts   map[string]int
+	failures map[string][]int
+}
+
+func newFakeCarFactory() *FakeCarFactory {
+	return &FakeCarFactory{
+		counts:   map[string]int{},
+		failures: map[string][]int{},
+	}
+}
+
+func (f *FakeCarFactory) withCars(cars ...ICar) *FakeCarFactory {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cars = cars
+	return f
+}
+
+func (f *FakeCarFactory) withCarDetails(details ...ICarDetails) *FakeCarFactory {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.details = details
+	return f
+}
+
+// Fails the given 1-based calls of a method, or every call when none are given
+func (f *FakeCarFactory) failOn(method string, calls ...int) *FakeCarFactory {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(calls) == 0 {
+		calls = []int{0}
+	}
+	f.failures[method] = append(f.failures[method], calls...)
+	return f
+}
+
+// Records the call and reports its 1-based number and whether it should fail
+func (f *FakeCarFactory) record(method string) (int, bool) {
+	f.calls = append(f.calls, method)
+	f.counts[method]++
+	call := f.counts[method]
+	failing := f.failures[method]
+	return call, slices.Contains(failing, 0) || slices.Contains(failing, call)
+}
+
+func (f *FakeCarFactory) makeCar() ICar {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call, failed := f.record(methodMakeCar)
+	if failed || len(f.cars) == 0 {
+		return nil
+	}
+	return f.cars[min(call, len(f.cars))-1]
+}
+
+func (f *FakeCarFactory) makeCarDetails() ICarDetails {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call, failed := f.record(methodMakeCarDetails)
+	if failed || len(f.details) == 0 {
+		return nil
+	}
+	return f.details[min(call, len(f.details))-1]
+}
+
+func (f *FakeCarFactory) callCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[method]
+}
+
+func (f *FakeCarFactory) callOrder() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Forgets recorded calls and scripted failures, the scripted products are kept
+func (f *FakeCarFactory) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.counts = map[string]int{}
+	f.failures = map[string][]int{}
+}
+
+// Assertion helpers return an error describing the mismatch, ready for t.Fatal
+
+func (f *FakeCarFactory) assertCalled(method string, times int) error {
+	if got := f.callCount(method); got != times {
+		return fmt.Errorf("expected %s to be called %d times, got %d", method, times, got)
+	}
+	return nil
+}
+
+func (f *FakeCarFactory) assertNotCalled(method string) error {
+	return f.assertCalled(method, 0)
+}
+
+func (f *FakeCarFactory) assertCallOrder(methods ...string) error {
+	if got := f.callOrder(); !slices.Equal(got, methods) {
+		return fmt.Errorf("expected calls [%s], got [%s]", strings.Join(methods, ", "), strings.Join(got, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpecMatrixWithFake(t *testing.T) {
+	cheap := newFakeCarFactory().
+		withCars(&Car{carType: "Cheap"}).
+		withCarDetails(&CarDetails{transmission: "manual", engine: "gas", gasType: "gas", fuelConsumption: 6, price: 15000})
+
+	matrix, err := newSpecMatrix(cheap, &LuxuryCarFactory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(matrix.families, ","); got != "Cheap,Luxury" {
+		t.Errorf("families = %s", got)
+	}
+	if err := cheap.assertCallOrder(methodMakeCar, methodMakeCarDetails); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSpecMatrixFailingFactory(t *testing.T) {
+	fake := newFakeCarFactory().
+		withCars(&Car{carType: "Fake"}).
+		withCarDetails(&CarDetails{engine: "gas"}).
+		failOn(methodMakeCar)
+
+	if _, err := newSpecMatrix(fake, &HybridCarFactory{}); err == nil {
+		t.Fatal("newSpecMatrix succeeded with a failing factory")
+	}
+	if err := fake.assertCalled(methodMakeCar, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunningCostWithFake(t *testing.T) {
+	prices := FuelPrices{perLitre: map[string]float64{"diesel": 2}, perKWh: 0.3}
+	fake := newFakeCarFactory().
+		withCars(&Car{carType: "Van"}).
+		withCarDetails(&CarDetails{engine: "diesel", gasType: "diesel", fuelConsumption: 8}).
+		failOn(methodMakeCarDetails, 2)
+
+	cost, err := calculateRunningCost(fake, 10000, prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.litres != 800 || cost.annualCost != 1600 {
+		t.Errorf("litres = %v, cost = %v, want 800 and 1600", cost.litres, cost.annualCost)
+	}
+
+	// The second call is scripted to fail
+	if _, err := calculateRunningCost(fake, 10000, prices); err == nil {
+		t.Error("calculateRunningCost succeeded without car details")
+	}
+	if err := fake.assertCalled(methodMakeCarDetails, 2); err != nil {
+		t.Error(err)
+	}
+
+	// Negative distances are rejected before the factory is used
+	fake.reset()
+	if _, err := calculateRunningCost(fake, -1, prices); err == nil {
+		t.Error("calculateRunningCost accepted a negative distance")
+	}
+	if err := fake.assertNotCalled(methodMakeCar); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeResetClearsFailures(t *testing.T) {
+	fake := newFakeCarFactory().withCars(&Car{carType: "Fake"}).failOn(methodMakeCar)
+	if fake.makeCar() != nil {
+		t.Fatal("makeCar did not fail")
+	}
+	fake.reset()
+	if fake.makeCar() == nil {
+		t.Error("makeCar still fails after reset")
+	}
+	if err := fake.assertCallOrder(methodMakeCar); err != nil {
+		t.Error(err)
+	}
+}
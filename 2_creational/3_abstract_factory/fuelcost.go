@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Kilograms of CO2 released per litre burned
+var co2PerLitre = map[string]float64{
+	"gas":     2.31,
+	"premium": 2.31,
+	"diesel":  2.68,
+}
+
+// Local prices used by the calculator
+type FuelPrices struct {
+	// Price per litre keyed by gas type: gas, premium, diesel
+	perLitre map[string]float64
+	perKWh   float64
+	// Kilograms of CO2 per kWh of the local grid
+	gridCO2PerKWh float64
+}
+
+// Yearly running cost of one family
+type RunningCost struct {
+	family     string
+	distanceKm float64
+	litres     float64
+	kWh        float64
+	annualCost float64
+	co2Kg      float64
+}
+
+// Cost over a number of years, for total cost of ownership comparisons
+func (rc RunningCost) costOver(years int) float64 {
+	return rc.annualCost * float64(years)
+}
+
+// Liquid fuel burned by the engine, hybrids with an "electric" gas type burn regular gas
+func liquidFuel(details ICarDetails) string {
+	switch details.getEngine() {
+	case "electric":
+		return ""
+	case "hybrid":
+		if details.getGasType() == "electric" {
+			return "gas"
+		}
+	}
+	return details.getGasType()
+}
+
+func calculateRunningCost(factory ICarFactory, distanceKm float64, prices FuelPrices) (RunningCost, error) {
+	if distanceKm < 0 {
+		return RunningCost{}, fmt.Errorf("yearly distance cannot be negative: %.0f km", distanceKm)
+	}
+
+	car, details := factory.makeCar(), factory.makeCarDetails()
+	if car == nil || details == nil {
+		return RunningCost{}, errors.New("car factory did not make a car and its details")
+	}
+	cost := RunningCost{
+		family:     car.getCarType(),
+		distanceKm: distanceKm,
+	}
+
+	if fuel := liquidFuel(details); fuel != "" && details.getFuelConsumption() > 0 {
+		price, ok := prices.perLitre[fuel]
+		if !ok {
+			return RunningCost{}, fmt.Errorf("%s: no local price for %s", cost.family, fuel)
+		}
+		cost.litres = distanceKm / 100 * details.getFuelConsumption()
+		cost.annualCost += cost.litres * price
+		cost.co2Kg += cost.litres * co2PerLitre[fuel]
+	}
+
+	if details.getElectricConsumption() > 0 {
+		cost.kWh = distanceKm / 100 * details.getElectricConsumption()
+		cost.annualCost += cost.kWh * prices.perKWh
+		cost.co2Kg += cost.kWh * prices.gridCO2PerKWh
+	}
+
+	if cost.litres == 0 && cost.kWh == 0 && distanceKm > 0 {
+		return RunningCost{}, fmt.Errorf("%s: no fuel or electric consumption", cost.family)
+	}
+
+	return cost, nil
+}
+
+// Same distance and prices for every family so the results are comparable
+func calculateRunningCosts(factories []ICarFactory, distanceKm float64, prices FuelPrices) ([]RunningCost, error) {
+	costs := make([]RunningCost, 0, len(factories))
+	for _, factory := range factories {
+		cost, err := calculateRunningCost(factory, distanceKm, prices)
+		if err != nil {
+			return nil, err
+		}
+		costs = append(costs, cost)
+	}
+	return costs, nil
+}
+
+func writeRunningCosts(w io.Writer, costs []RunningCost, years int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Family\tLitres\tkWh\tYearly Cost\tCO2 (kg)\t%d Year Cost\n", years)
+	for _, c := range costs {
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%.2f\t%.0f\t%.2f\n", c.family, c.litres, c.kWh, c.annualCost, c.co2Kg, c.costOver(years))
+	}
+	return tw.Flush()
+}
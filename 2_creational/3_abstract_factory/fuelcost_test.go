@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCalculateRunningCost(t *testing.T) {
+	prices := FuelPrices{
+		perLitre:      map[string]float64{"gas": 1.5, "premium": 2},
+		perKWh:        0.3,
+		gridCO2PerKWh: 0.2,
+	}
+	tests := []struct {
+		name    string
+		details *CarDetails
+		want    RunningCost
+		wantErr string
+	}{
+		{
+			name:    "premium fuel",
+			details: &CarDetails{engine: "gas", gasType: "premium", fuelConsumption: 10},
+			want:    RunningCost{litres: 1000, annualCost: 2000, co2Kg: 2310},
+		},
+		{
+			// The "electric" gas type of a hybrid is costed as regular gas plus the charge
+			name:    "hybrid",
+			details: &CarDetails{engine: "hybrid", gasType: "electric", fuelConsumption: 4, electricConsumption: 10},
+			want:    RunningCost{litres: 400, kWh: 1000, annualCost: 900, co2Kg: 1124},
+		},
+		{
+			name:    "electric",
+			details: &CarDetails{engine: "electric", gasType: "electric", electricConsumption: 16},
+			want:    RunningCost{kWh: 1600, annualCost: 480, co2Kg: 320},
+		},
+		{
+			name:    "missing local price",
+			details: &CarDetails{engine: "diesel", gasType: "diesel", fuelConsumption: 6},
+			wantErr: "no local price for diesel",
+		},
+		{
+			name:    "zero consumption",
+			details: &CarDetails{engine: "gas", gasType: "gas"},
+			wantErr: "no fuel or electric consumption",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := newFakeCarFactory().withCars(&Car{carType: "Test"}).withCarDetails(tt.details)
+			cost, err := calculateRunningCost(factory, 10000, prices)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cost.family != "Test" || cost.distanceKm != 10000 {
+				t.Errorf("family = %q, distance = %v", cost.family, cost.distanceKm)
+			}
+			for _, f := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"litres", cost.litres, tt.want.litres},
+				{"kWh", cost.kWh, tt.want.kWh},
+				{"annual cost", cost.annualCost, tt.want.annualCost},
+				{"CO2", cost.co2Kg, tt.want.co2Kg},
+			} {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.name, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunningCostZeroDistance(t *testing.T) {
+	// Nothing is driven, so a car without consumption figures costs nothing rather than failing
+	factory := newFakeCarFactory().withCars(&Car{carType: "Test"}).withCarDetails(&CarDetails{engine: "gas", gasType: "gas"})
+	cost, err := calculateRunningCost(factory, 0, FuelPrices{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.annualCost != 0 || cost.costOver(5) != 0 {
+		t.Errorf("cost = %+v, want nothing", cost)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+)
 
 // Abstract Product  1
 type ICar interface {
 	setCarType(carType string)
+	getCarType() string
 	printDetails()
 }
 
@@ -16,6 +22,10 @@ func (c *Car) setCarType(carType string) {
 	c.carType = carType
 }
 
+func (c *Car) getCarType() string {
+	return c.carType
+}
+
 func (c *Car) printDetails() {
 	fmt.Printf("Car Type: %s\n", c.carType)
 }
@@ -25,6 +35,15 @@ type ICarDetails interface {
 	setTransmission(transmission string)
 	setEngine(engine string)
 	setGasType(gasType string)
+	setFuelConsumption(litresPer100km float64)
+	setElectricConsumption(kWhPer100km float64)
+	setPrice(price float64)
+	getTransmission() string
+	getEngine() string
+	getGasType() string
+	getFuelConsumption() float64
+	getElectricConsumption() float64
+	getPrice() float64
 	printDetails()
 }
 
@@ -32,6 +51,11 @@ type CarDetails struct {
 	transmission string
 	engine       string
 	gasType      string
+	// Litres per 100 km
+	fuelConsumption float64
+	// kWh per 100 km
+	electricConsumption float64
+	price               float64
 }
 
 func (cd *CarDetails) setTransmission(transmission string) {
@@ -46,10 +70,49 @@ func (cd *CarDetails) setGasType(gasType string) {
 	cd.gasType = gasType
 }
 
+func (cd *CarDetails) setFuelConsumption(litresPer100km float64) {
+	cd.fuelConsumption = litresPer100km
+}
+
+func (cd *CarDetails) setElectricConsumption(kWhPer100km float64) {
+	cd.electricConsumption = kWhPer100km
+}
+
+func (cd *CarDetails) setPrice(price float64) {
+	cd.price = price
+}
+
+func (cd *CarDetails) getTransmission() string {
+	return cd.transmission
+}
+
+func (cd *CarDetails) getEngine() string {
+	return cd.engine
+}
+
+func (cd *CarDetails) getGasType() string {
+	return cd.gasType
+}
+
+func (cd *CarDetails) getFuelConsumption() float64 {
+	return cd.fuelConsumption
+}
+
+func (cd *CarDetails) getElectricConsumption() float64 {
+	return cd.electricConsumption
+}
+
+func (cd *CarDetails) getPrice() float64 {
+	return cd.price
+}
+
 func (cd *CarDetails) printDetails() {
 	fmt.Printf("Car Transmission: %s\n", cd.transmission)
 	fmt.Printf("Car Engine: %s\n", cd.engine)
 	fmt.Printf("Car Gas Type: %s\n", cd.gasType)
+	fmt.Printf("Car Fuel Consumption: %.1f L/100km\n", cd.fuelConsumption)
+	fmt.Printf("Car Electric Consumption: %.1f kWh/100km\n", cd.electricConsumption)
+	fmt.Printf("Car Price: %.2f\n", cd.price)
 	fmt.Println()
 }
 
@@ -95,9 +158,11 @@ func (l *LuxuryCarFactory) makeCar() ICar {
 func (l *LuxuryCarFactory) makeCarDetails() ICarDetails {
 	return &LuxuryCarDetails{
 		CarDetails: CarDetails{
-			transmission: "manual",
-			engine:       "gas",
-			gasType:      "premium",
+			transmission:    "manual",
+			engine:          "gas",
+			gasType:         "premium",
+			fuelConsumption: 9.5,
+			price:           65000,
 		},
 	}
 }
@@ -116,24 +181,44 @@ func (l *HybridCarFactory) makeCar() ICar {
 func (l *HybridCarFactory) makeCarDetails() ICarDetails {
 	return &HybridCarDetails{
 		CarDetails: CarDetails{
-			transmission: "automatic",
-			engine:       "hybrid",
-			gasType:      "electric",
+			transmission:        "automatic",
+			engine:              "hybrid",
+			gasType:             "electric",
+			fuelConsumption:     4.2,
+			electricConsumption: 3.0,
+			price:               32000,
 		},
 	}
 }
 
-// factory method
-func getCarFactory(carType string) ICarFactory {
-	if carType == "luxury" {
-		return &LuxuryCarFactory{}
+// Registered factory families
+var (
+	carFactoriesMu sync.RWMutex
+	carFactories   = map[string]ICarFactory{
+		"luxury": &LuxuryCarFactory{},
+		"hybrid": &HybridCarFactory{},
 	}
+)
 
-	if carType == "hybrid" {
-		return &HybridCarFactory{}
-	}
+// Adds or replaces a family, safe to call while others look factories up
+func registerCarFactory(carType string, factory ICarFactory) {
+	carFactoriesMu.Lock()
+	defer carFactoriesMu.Unlock()
+	carFactories[carType] = factory
+}
 
-	return nil
+// factory method
+func getCarFactory(carType string) ICarFactory {
+	carFactoriesMu.RLock()
+	defer carFactoriesMu.RUnlock()
+	return carFactories[carType]
+}
+
+// Copy of the registry, so callers can range over it without holding the lock
+func registeredCarFactories() map[string]ICarFactory {
+	carFactoriesMu.RLock()
+	defer carFactoriesMu.RUnlock()
+	return maps.Clone(carFactories)
 }
 
 func main() {
@@ -153,4 +238,81 @@ func main() {
 
 	hybridCar.printDetails()
 	hybridCarDetails.printDetails()
+
+	// Compare the families side by side
+	matrix, err := newSpecMatrix(luxuryFactory, hybridFactory)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	matrix.writeTable(os.Stdout)
+	fmt.Println()
+	matrix.writeMarkdown(os.Stdout)
+	fmt.Println()
+	matrix.writeCSV(os.Stdout)
+	fmt.Println()
+
+	// Region specific variants of the same family
+	for _, region := range []*Region{regionEU, regionUS} {
+		regionalFactory := newRegionalCarFactory(luxuryFactory, region)
+		regionalDetails, err := regionalFactory.makeValidatedCarDetails()
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		regionalDetails.printDetails()
+	}
+
+	// Running costs for 15000 km a year
+	prices := FuelPrices{
+		perLitre: map[string]float64{
+			"gas":     1.75,
+			"premium": 1.95,
+			"diesel":  1.70,
+		},
+		perKWh:        0.30,
+		gridCO2PerKWh: 0.25,
+	}
+	costs, err := calculateRunningCosts([]ICarFactory{luxuryFactory, hybridFactory}, 15000, prices)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	writeRunningCosts(os.Stdout, costs, 5)
+	fmt.Println()
+
+	// Fake family recording how consumers use it
+	fake := newFakeCarFactory().
+		withCars(&Car{carType: "Fake"}).
+		withCarDetails(&CarDetails{transmission: "automatic", engine: "electric", gasType: "electric", electricConsumption: 15}).
+		failOn(methodMakeCarDetails, 2)
+
+	if _, err := newSpecMatrix(fake, luxuryFactory); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := newSpecMatrix(fake, luxuryFactory); err != nil {
+		fmt.Println("Injected failure:", err)
+	}
+	fmt.Println("Fake calls:", fake.callOrder())
+	if err := fake.assertCalled(methodMakeCarDetails, 2); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	// Let the buyer's preferences pick the family
+	preferences := BuyerPreferences{
+		budget:       40000,
+		transmission: "automatic",
+		ecoPriority:  0.8,
+	}
+	for _, r := range recommendCarFactories(preferences) {
+		fmt.Printf("%s: %.2f\n", r.carType, r.score)
+		for _, reason := range r.reasons {
+			fmt.Printf("  - %s\n", reason)
+		}
+	}
+	if best := recommendCarFactory(preferences); best != nil {
+		best.makeCar().printDetails()
+	}
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Grid intensity used for eco scores, in kg of CO2 per kWh
+const defaultGridCO2PerKWh = 0.25
+
+// Emissions at or above this many kg of CO2 per 100 km score zero for eco
+const maxCO2Per100km = 30.0
+
+// What the buyer is looking for, zero values mean no preference
+type BuyerPreferences struct {
+	budget       float64
+	transmission string
+	// Matches either the gas type or the engine, e.g. "diesel" or "hybrid"
+	fuelType string
+	// Weight between 0 and 1 given to the eco score
+	ecoPriority float64
+}
+
+// Scored family with the reasons behind its score
+type Recommendation struct {
+	carType string
+	factory ICarFactory
+	score   float64
+	reasons []string
+}
+
+// Criterion score between 0 and 1 and its weight in the total
+type criterion struct {
+	weight float64
+	score  float64
+	reason string
+}
+
+func co2Per100km(details ICarDetails) float64 {
+	co2 := details.getElectricConsumption() * defaultGridCO2PerKWh
+	if fuel := liquidFuel(details); fuel != "" {
+		co2 += details.getFuelConsumption() * co2PerLitre[fuel]
+	}
+	return co2
+}
+
+func scoreCarDetails(details ICarDetails, prefs BuyerPreferences) []criterion {
+	var criteria []criterion
+
+	if prefs.budget > 0 {
+		price := details.getPrice()
+		switch {
+		case price == 0:
+			criteria = append(criteria, criterion{1, 0.5, "price unknown"})
+		case price <= prefs.budget:
+			criteria = append(criteria, criterion{1, 1, fmt.Sprintf("within budget at %.2f", price)})
+		default:
+			over := price - prefs.budget
+			criteria = append(criteria, criterion{1, max(0, 1-over/prefs.budget), fmt.Sprintf("%.2f over budget", over)})
+		}
+	}
+
+	if prefs.transmission != "" {
+		if details.getTransmission() == prefs.transmission {
+			criteria = append(criteria, criterion{1, 1, prefs.transmission + " transmission as preferred"})
+		} else {
+			criteria = append(criteria, criterion{1, 0, fmt.Sprintf("%s transmission, %s preferred", details.getTransmission(), prefs.transmission)})
+		}
+	}
+
+	if prefs.fuelType != "" {
+		if details.getGasType() == prefs.fuelType || details.getEngine() == prefs.fuelType {
+			criteria = append(criteria, criterion{1, 1, prefs.fuelType + " as preferred"})
+		} else {
+			criteria = append(criteria, criterion{1, 0, fmt.Sprintf("%s %s engine, %s preferred", details.getGasType(), details.getEngine(), prefs.fuelType)})
+		}
+	}
+
+	if priority := min(max(prefs.ecoPriority, 0), 1); priority > 0 {
+		co2 := co2Per100km(details)
+		eco := max(0, 1-co2/maxCO2Per100km)
+		criteria = append(criteria, criterion{priority, eco, fmt.Sprintf("eco score %.2f at %.1f kg CO2/100km", eco, co2)})
+	}
+
+	return criteria
+}
+
+// Ranks every registered family, best match first
+func recommendCarFactories(prefs BuyerPreferences) []Recommendation {
+	var recommendations []Recommendation
+	factories := registeredCarFactories()
+	for _, carType := range slices.Sorted(maps.Keys(factories)) {
+		factory := factories[carType]
+		details := factory.makeCarDetails()
+		if details == nil {
+			continue
+		}
+
+		r := Recommendation{carType: carType, factory: factory}
+		var total, weights float64
+		for _, c := range scoreCarDetails(details, prefs) {
+			total += c.weight * c.score
+			weights += c.weight
+			r.reasons = append(r.reasons, c.reason)
+		}
+		if weights > 0 {
+			r.score = total / weights
+		}
+		recommendations = append(recommendations, r)
+	}
+
+	slices.SortStableFunc(recommendations, func(a, b Recommendation) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	return recommendations
+}
+
+// Best matching family, or nil when none are registered
+func recommendCarFactory(prefs BuyerPreferences) ICarFactory {
+	recommendations := recommendCarFactories(prefs)
+	if len(recommendations) == 0 {
+		return nil
+	}
+	return recommendations[0].factory
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestRegisterCarFactoryWhileRecommending(t *testing.T) {
+	t.Cleanup(func() {
+		carFactoriesMu.Lock()
+		defer carFactoriesMu.Unlock()
+		for carType := range carFactories {
+			if carType != "luxury" && carType != "hybrid" {
+				delete(carFactories, carType)
+			}
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			registerCarFactory(fmt.Sprintf("fake%d", i), newFakeCarFactory().
+				withCarDetails(&CarDetails{engine: "gas", gasType: "gas", fuelConsumption: 7, price: 20000}))
+		}()
+		go func() {
+			defer wg.Done()
+			recommendCarFactories(BuyerPreferences{})
+		}()
+	}
+	wg.Wait()
+
+	if got := len(recommendCarFactories(BuyerPreferences{})); got != 22 {
+		t.Errorf("recommended %d families, want 22", got)
+	}
+	if getCarFactory("fake7") == nil {
+		t.Error("registered factory not found")
+	}
+}
+
+// Replaces the registered families for one test
+func withCarFactories(t *testing.T, factories map[string]ICarFactory) {
+	t.Helper()
+	carFactoriesMu.Lock()
+	previous := carFactories
+	carFactories = factories
+	carFactoriesMu.Unlock()
+	t.Cleanup(func() {
+		carFactoriesMu.Lock()
+		carFactories = previous
+		carFactoriesMu.Unlock()
+	})
+}
+
+func TestScoreCarDetails(t *testing.T) {
+	petrol := &CarDetails{transmission: "manual", engine: "gas", gasType: "gas", fuelConsumption: 6, price: 20000}
+	hybrid := &CarDetails{transmission: "automatic", engine: "hybrid", gasType: "electric", fuelConsumption: 4, electricConsumption: 10}
+
+	tests := []struct {
+		name    string
+		details ICarDetails
+		prefs   BuyerPreferences
+		want    []criterion
+	}{
+		{"no preferences", petrol, BuyerPreferences{}, nil},
+		{"within budget", petrol, BuyerPreferences{budget: 25000}, []criterion{{1, 1, "within budget at 20000.00"}}},
+		{"over budget", petrol, BuyerPreferences{budget: 16000}, []criterion{{1, 0.75, "4000.00 over budget"}}},
+		{"twice the budget", petrol, BuyerPreferences{budget: 10000}, []criterion{{1, 0, "10000.00 over budget"}}},
+		{"price unknown", hybrid, BuyerPreferences{budget: 10000}, []criterion{{1, 0.5, "price unknown"}}},
+		{"transmission match", petrol, BuyerPreferences{transmission: "manual"}, []criterion{{1, 1, "manual transmission as preferred"}}},
+		{"transmission mismatch", hybrid, BuyerPreferences{transmission: "manual"}, []criterion{{1, 0, "automatic transmission, manual preferred"}}},
+		{"fuel match by gas type", petrol, BuyerPreferences{fuelType: "gas"}, []criterion{{1, 1, "gas as preferred"}}},
+		{"fuel match by engine", hybrid, BuyerPreferences{fuelType: "hybrid"}, []criterion{{1, 1, "hybrid as preferred"}}},
+		{"fuel mismatch", petrol, BuyerPreferences{fuelType: "diesel"}, []criterion{{1, 0, "gas gas engine, diesel preferred"}}},
+		// 6 L of petrol is 13.86 kg of CO2
+		{"eco", petrol, BuyerPreferences{ecoPriority: 0.5}, []criterion{{0.5, 1 - 13.86/30, "eco score 0.54 at 13.9 kg CO2/100km"}}},
+		{"eco priority clamped", petrol, BuyerPreferences{ecoPriority: 3}, []criterion{{1, 1 - 13.86/30, "eco score 0.54 at 13.9 kg CO2/100km"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreCarDetails(tt.details, tt.prefs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("criteria = %+v, want %+v", got, tt.want)
+			}
+			for i, c := range got {
+				want := tt.want[i]
+				if c.reason != want.reason || c.weight != want.weight || math.Abs(c.score-want.score) > 1e-9 {
+					t.Errorf("criterion %d = %+v, want %+v", i, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommendCarFactoriesRanking(t *testing.T) {
+	withCarFactories(t, map[string]ICarFactory{
+		"thirsty": newFakeCarFactory().withCarDetails(&CarDetails{transmission: "manual", engine: "gas", gasType: "gas", fuelConsumption: 10, price: 20000}),
+		"green":   newFakeCarFactory().withCarDetails(&CarDetails{transmission: "automatic", engine: "electric", gasType: "electric", electricConsumption: 16, price: 40000}),
+		"broken":  newFakeCarFactory().withCarDetails(&CarDetails{price: 1}).failOn(methodMakeCarDetails),
+	})
+
+	tests := []struct {
+		name    string
+		prefs   BuyerPreferences
+		order   []string
+		reasons []string
+	}{
+		{
+			name:    "budget only",
+			prefs:   BuyerPreferences{budget: 30000},
+			order:   []string{"thirsty", "green"},
+			reasons: []string{"within budget at 20000.00"},
+		},
+		{
+			// Weighing emissions equally with price puts the cleaner car first
+			name:    "eco weighted",
+			prefs:   BuyerPreferences{budget: 30000, ecoPriority: 1},
+			order:   []string{"green", "thirsty"},
+			reasons: []string{"10000.00 over budget", "eco score 0.87 at 4.0 kg CO2/100km"},
+		},
+		{
+			name:    "transmission",
+			prefs:   BuyerPreferences{budget: 30000, transmission: "automatic", ecoPriority: 0.1},
+			order:   []string{"green", "thirsty"},
+			reasons: []string{"10000.00 over budget", "automatic transmission as preferred", "eco score 0.87 at 4.0 kg CO2/100km"},
+		},
+		{
+			name:    "no preferences keep the name order",
+			prefs:   BuyerPreferences{},
+			order:   []string{"green", "thirsty"},
+			reasons: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommendations := recommendCarFactories(tt.prefs)
+			var order []string
+			for _, r := range recommendations {
+				order = append(order, r.carType)
+			}
+			if !slices.Equal(order, tt.order) {
+				t.Fatalf("order = %v, want %v", order, tt.order)
+			}
+			if got := recommendations[0].reasons; !slices.Equal(got, tt.reasons) {
+				t.Errorf("reasons = %q, want %q", got, tt.reasons)
+			}
+			if recommendCarFactory(tt.prefs) != recommendations[0].factory {
+				t.Error("recommendCarFactory does not return the best match")
+			}
+		})
+	}
+}
+
+func TestRecommendWithoutFactories(t *testing.T) {
+	withCarFactories(t, map[string]ICarFactory{})
+	if factory := recommendCarFactory(BuyerPreferences{budget: 1}); factory != nil {
+		t.Errorf("recommended %v with nothing registered", factory)
+	}
+}
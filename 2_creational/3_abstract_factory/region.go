@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Region specific presentation and compliance rules
+type Region struct {
+	name              string
+	emissionsStandard string
+	// Canonical gas type to the name used in the region
+	fuelNames       map[string]string
+	consumptionUnit string
+	// Converts litres per 100 km to the regional unit
+	convertConsumption func(litresPer100km float64) float64
+	electricUnit       string
+	// Converts kWh per 100 km to the regional unit
+	convertElectric func(kWhPer100km float64) float64
+	requiredFields  []regionalField
+}
+
+// Field a region requires to be populated before a car can be sold there
+type regionalField struct {
+	name  string
+	value func(*RegionalCarDetails) string
+}
+
+var requiredRegionalFields = []regionalField{
+	{name: "transmission", value: (*RegionalCarDetails).getTransmission},
+	{name: "engine", value: (*RegionalCarDetails).getEngine},
+	{name: "fuel name", value: (*RegionalCarDetails).getFuelName},
+	{name: "fuel consumption", value: func(d *RegionalCarDetails) string {
+		if d.getFuelConsumption() <= 0 && d.getElectricConsumption() <= 0 {
+			return ""
+		}
+		return d.getFuelConsumptionLabel()
+	}},
+	{name: "emissions standard", value: (*RegionalCarDetails).getEmissionsStandard},
+}
+
+var regionEU = &Region{
+	name:              "EU",
+	emissionsStandard: "Euro 6",
+	fuelNames: map[string]string{
+		"gas":      "petrol",
+		"premium":  "super unleaded petrol",
+		"diesel":   "diesel",
+		"electric": "electricity",
+	},
+	consumptionUnit: "L/100km",
+	convertConsumption: func(litresPer100km float64) float64 {
+		return litresPer100km
+	},
+	electricUnit: "kWh/100km",
+	convertElectric: func(kWhPer100km float64) float64 {
+		return kWhPer100km
+	},
+	requiredFields: requiredRegionalFields,
+}
+
+var regionUS = &Region{
+	name:              "US",
+	emissionsStandard: "EPA Tier 3",
+	fuelNames: map[string]string{
+		"gas":      "gas",
+		"premium":  "premium gas",
+		"diesel":   "diesel",
+		"electric": "electricity",
+	},
+	consumptionUnit: "mpg",
+	convertConsumption: func(litresPer100km float64) float64 {
+		if litresPer100km == 0 {
+			return 0
+		}
+		return 235.215 / litresPer100km
+	},
+	// Miles per gallon equivalent, a gallon of gas being 33.705 kWh
+	electricUnit: "MPGe",
+	convertElectric: func(kWhPer100km float64) float64 {
+		if kWhPer100km == 0 {
+			return 0
+		}
+		return 33.705 * 100 / (kWhPer100km * 1.609344)
+	},
+	requiredFields: requiredRegionalFields,
+}
+
+// Regional product variant wrapping the details of any family
+type RegionalCarDetails struct {
+	ICarDetails
+	region *Region
+}
+
+func (rd *RegionalCarDetails) getFuelName() string {
+	return rd.region.fuelNames[rd.getGasType()]
+}
+
+func (rd *RegionalCarDetails) getEmissionsStandard() string {
+	return rd.region.emissionsStandard
+}
+
+// Liquid and electric consumption in the regional units, both for a plug-in hybrid
+func (rd *RegionalCarDetails) getFuelConsumptionLabel() string {
+	var labels []string
+	if litres := rd.getFuelConsumption(); litres > 0 {
+		labels = append(labels, fmt.Sprintf("%.1f %s", rd.region.convertConsumption(litres), rd.region.consumptionUnit))
+	}
+	if kWh := rd.getElectricConsumption(); kWh > 0 {
+		labels = append(labels, fmt.Sprintf("%.1f %s", rd.region.convertElectric(kWh), rd.region.electricUnit))
+	}
+	return strings.Join(labels, " + ")
+}
+
+// Reports every required field the region is missing
+func (rd *RegionalCarDetails) validate() error {
+	var errs []error
+	for _, field := range rd.region.requiredFields {
+		if field.value(rd) == "" {
+			errs = append(errs, fmt.Errorf("%s: missing %s", rd.region.name, field.name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (rd *RegionalCarDetails) printDetails() {
+	fmt.Printf("Region: %s\n", rd.region.name)
+	fmt.Printf("Car Transmission: %s\n", rd.getTransmission())
+	fmt.Printf("Car Engine: %s\n", rd.getEngine())
+	fmt.Printf("Car Fuel: %s\n", rd.getFuelName())
+	fmt.Printf("Car Fuel Consumption: %s\n", rd.getFuelConsumptionLabel())
+	fmt.Printf("Car Emissions Standard: %s\n", rd.getEmissionsStandard())
+	fmt.Println()
+}
+
+// Region aware factory wrapping any car factory family
+type RegionalCarFactory struct {
+	factory ICarFactory
+	region  *Region
+}
+
+func newRegionalCarFactory(factory ICarFactory, region *Region) *RegionalCarFactory {
+	return &RegionalCarFactory{
+		factory: factory,
+		region:  region,
+	}
+}
+
+func (r *RegionalCarFactory) makeCar() ICar {
+	return r.factory.makeCar()
+}
+
+// Nil when the wrapped factory returns nil, rather than details wrapping nothing
+func (r *RegionalCarFactory) makeCarDetails() ICarDetails {
+	details := r.factory.makeCarDetails()
+	if details == nil {
+		return nil
+	}
+	return &RegionalCarDetails{
+		ICarDetails: details,
+		region:      r.region,
+	}
+}
+
+// Builds the regional details and fails if the region's required fields are not all populated
+func (r *RegionalCarFactory) makeValidatedCarDetails() (*RegionalCarDetails, error) {
+	details, ok := r.makeCarDetails().(*RegionalCarDetails)
+	if !ok {
+		return nil, fmt.Errorf("%s: factory returned no car details", r.region.name)
+	}
+	if err := details.validate(); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func electricCarDetails() *CarDetails {
+	return &CarDetails{
+		transmission:        "automatic",
+		engine:              "electric",
+		gasType:             "electric",
+		electricConsumption: 16,
+	}
+}
+
+func TestElectricConsumptionLabel(t *testing.T) {
+	tests := []struct {
+		region *Region
+		want   string
+	}{
+		{regionEU, "16.0 kWh/100km"},
+		{regionUS, "130.9 MPGe"},
+	}
+	for _, tt := range tests {
+		factory := newRegionalCarFactory(newFakeCarFactory().withCarDetails(electricCarDetails()), tt.region)
+		details, err := factory.makeValidatedCarDetails()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.region.name, err)
+		}
+		if got := details.getFuelConsumptionLabel(); got != tt.want {
+			t.Errorf("%s: label = %q, want %q", tt.region.name, got, tt.want)
+		}
+	}
+}
+
+func TestHybridConsumptionLabel(t *testing.T) {
+	details := newRegionalCarFactory(&HybridCarFactory{}, regionEU).makeCarDetails().(*RegionalCarDetails)
+	if got, want := details.getFuelConsumptionLabel(), "4.2 L/100km + 3.0 kWh/100km"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+}
+
+func TestRegionalFactoryWithoutDetails(t *testing.T) {
+	factory := newRegionalCarFactory(newFakeCarFactory().failOn(methodMakeCarDetails), regionUS)
+	if details := factory.makeCarDetails(); details != nil {
+		t.Errorf("makeCarDetails = %v, want nil", details)
+	}
+	if _, err := factory.makeValidatedCarDetails(); err == nil {
+		t.Error("makeValidatedCarDetails succeeded without details")
+	}
+}
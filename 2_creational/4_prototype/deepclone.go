@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Hook for types that know how to copy themselves, used by DeepClone instead of reflection.
+// The returned value must be assignable to the type being cloned.
+type Cloner interface {
+	cloneValue() (any, error)
+}
+
+var clonerType = reflect.TypeFor[Cloner]()
+
+// Struct tag controlling how DeepClone copies a field:
+// `clone:"-"` leaves the field zero, `clone:"shallow"` shares the original value
+const cloneTag = "clone"
+
+// Already copied pointers, maps and slices, so shared references and cycles are preserved
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type deepCopier struct {
+	visited map[visitKey]reflect.Value
+}
+
+// Deep copy of v built with reflection, unexported fields included.
+// Functions and channels are shared with the original since they cannot be copied.
+func DeepClone[T any](v T) (T, error) {
+	c := &deepCopier{visited: map[visitKey]reflect.Value{}}
+	dst, err := c.copy(reflect.ValueOf(&v).Elem())
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	// Set rather than a type assertion, which panics on a nil interface T
+	var out T
+	reflect.ValueOf(&out).Elem().Set(dst)
+	return out, nil
+}
+
+// Field value that can be read and written even when unexported
+func exposed(v reflect.Value) reflect.Value {
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
+
+func (c *deepCopier) copy(src reflect.Value) (reflect.Value, error) {
+	t := src.Type()
+
+	nilable := t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface
+	if t.Implements(clonerType) && !(nilable && src.IsNil()) {
+		cloned, err := src.Interface().(Cloner).cloneValue()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.ValueOf(cloned)
+		if !v.IsValid() || !v.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("cloneValue of %s returned %T", t, cloned)
+		}
+		dst := reflect.New(t).Elem()
+		dst.Set(v)
+		return dst, nil
+	}
+
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return reflect.Zero(t), nil
+		}
+		key := visitKey{ptr: src.Pointer(), typ: t}
+		if dst, ok := c.visited[key]; ok {
+			return dst, nil
+		}
+		dst := reflect.New(t.Elem())
+		c.visited[key] = dst
+		elem, err := c.copy(src.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dst.Elem().Set(elem)
+		return dst, nil
+
+	case reflect.Struct:
+		if !src.CanAddr() {
+			addressable := reflect.New(t).Elem()
+			addressable.Set(src)
+			src = addressable
+		}
+		dst := reflect.New(t).Elem()
+		for i := range t.NumField() {
+			field := exposed(dst.Field(i))
+			value := exposed(src.Field(i))
+			switch t.Field(i).Tag.Get(cloneTag) {
+			case "-":
+				continue
+			case "shallow":
+				field.Set(value)
+				continue
+			}
+			copied, err := c.copy(value)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s.%s: %w", t, t.Field(i).Name, err)
+			}
+			field.Set(copied)
+		}
+		return dst, nil
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return reflect.Zero(t), nil
+		}
+		key := visitKey{ptr: src.Pointer(), typ: t, len: src.Len()}
+		if dst, ok := c.visited[key]; ok {
+			return dst, nil
+		}
+		dst := reflect.MakeSlice(t, src.Len(), src.Cap())
+		c.visited[key] = dst
+		for i := range src.Len() {
+			elem, err := c.copy(src.Index(i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			dst.Index(i).Set(elem)
+		}
+		return dst, nil
+
+	case reflect.Array:
+		dst := reflect.New(t).Elem()
+		for i := range src.Len() {
+			elem, err := c.copy(src.Index(i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			dst.Index(i).Set(elem)
+		}
+		return dst, nil
+
+	case reflect.Map:
+		if src.IsNil() {
+			return reflect.Zero(t), nil
+		}
+		key := visitKey{ptr: src.Pointer(), typ: t}
+		if dst, ok := c.visited[key]; ok {
+			return dst, nil
+		}
+		dst := reflect.MakeMapWithSize(t, src.Len())
+		c.visited[key] = dst
+		iter := src.MapRange()
+		for iter.Next() {
+			k, err := c.copy(iter.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := c.copy(iter.Value())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			dst.SetMapIndex(k, v)
+		}
+		return dst, nil
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return reflect.Zero(t), nil
+		}
+		elem, err := c.copy(src.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dst := reflect.New(t).Elem()
+		dst.Set(elem)
+		return dst, nil
+
+	case reflect.UnsafePointer:
+		return reflect.Value{}, fmt.Errorf("cannot deep clone %s", t)
+
+	default:
+		// Basic kinds are values already, functions and channels are shared
+		dst := reflect.New(t).Elem()
+		dst.Set(src)
+		return dst, nil
+	}
+}
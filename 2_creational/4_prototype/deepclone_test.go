@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+type linkedNode struct {
+	value int
+	next  *linkedNode
+}
+
+func TestDeepCloneCycle(t *testing.T) {
+	a := &linkedNode{value: 1}
+	b := &linkedNode{value: 2, next: a}
+	a.next = b
+
+	clone, err := DeepClone(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone == a || clone.next == b {
+		t.Fatal("clone shares nodes with the original")
+	}
+	if clone.next.next != clone {
+		t.Error("cycle not preserved in the clone")
+	}
+	if clone.value != 1 || clone.next.value != 2 {
+		t.Errorf("values = %d, %d, want 1, 2", clone.value, clone.next.value)
+	}
+}
+
+func TestDeepCloneSharedReferences(t *testing.T) {
+	style := Style{"stroke": "black"}
+	pair := []*Circle{{style: style}, {style: style}}
+
+	clone, err := DeepClone(pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone[0].style["stroke"] = "red"
+	if clone[1].style["stroke"] != "red" {
+		t.Error("a map shared in the original is not shared in the clone")
+	}
+	if style["stroke"] != "black" {
+		t.Error("clone changed the original map")
+	}
+}
+
+type tagged struct {
+	copied  []int
+	skipped []int `clone:"-"`
+	shared  []int `clone:"shallow"`
+}
+
+func TestDeepCloneTags(t *testing.T) {
+	src := tagged{copied: []int{1}, skipped: []int{2}, shared: []int{3}}
+
+	clone, err := DeepClone(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.skipped != nil {
+		t.Errorf(`clone:"-" field = %v, want nil`, clone.skipped)
+	}
+	clone.copied[0] = 10
+	clone.shared[0] = 30
+	if src.copied[0] != 1 {
+		t.Error("deep copied field shares its backing array")
+	}
+	if src.shared[0] != 30 {
+		t.Error(`clone:"shallow" field was copied`)
+	}
+}
+
+func TestDeepCloneUnexportedFields(t *testing.T) {
+	src := &Polygon{color: "Yellow", vertices: []Point{{0, 0}, {4, 0}}, style: Style{"fill": "yellow"}}
+
+	clone, err := DeepClone(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.vertices[0] = Point{9, 9}
+	clone.style["fill"] = "blue"
+	if clone.color != "Yellow" {
+		t.Errorf("color = %q, want Yellow", clone.color)
+	}
+	if src.vertices[0] != (Point{0, 0}) || src.style["fill"] != "yellow" {
+		t.Error("clone shares unexported slices or maps with the original")
+	}
+}
+
+// Copies itself by hand and counts the calls
+type countingCloner struct {
+	calls *int
+	fail  bool
+}
+
+func (c countingCloner) cloneValue() (any, error) {
+	*c.calls++
+	if c.fail {
+		return nil, errors.New("cannot clone")
+	}
+	return countingCloner{calls: c.calls}, nil
+}
+
+type holder struct {
+	item countingCloner
+}
+
+func TestDeepCloneClonerHook(t *testing.T) {
+	calls := 0
+	clone, err := DeepClone(holder{item: countingCloner{calls: &calls}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("cloneValue called %d times, want 1", calls)
+	}
+	// The hook decides what is copied, here the counter stays shared
+	if clone.item.calls != &calls {
+		t.Error("hook result not used")
+	}
+
+	if _, err := DeepClone(holder{item: countingCloner{calls: &calls, fail: true}}); err == nil {
+		t.Error("hook error not returned")
+	}
+}
+
+func TestDeepCloneNilInterface(t *testing.T) {
+	clone, err := DeepClone[Shape](nil)
+	if err != nil || clone != nil {
+		t.Errorf("DeepClone(nil) = %v, %v, want nil, nil", clone, err)
+	}
+}
+
+func TestDeepCloneSharesFunctions(t *testing.T) {
+	type withFunc struct{ fn func() }
+	if _, err := DeepClone(withFunc{fn: func() {}}); err != nil {
+		t.Errorf("functions should be shared, got %v", err)
+	}
+}
+
+// Circle.clone prints, which would otherwise dominate the benchmark
+func silenceStdout(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func benchmarkCircle() *Circle {
+	return &Circle{color: "Green", center: Point{1, 1}, radius: 2, style: Style{"stroke": "black"}}
+}
+
+func BenchmarkCircleClone(b *testing.B) {
+	silenceStdout(b)
+	circle := benchmarkCircle()
+	for b.Loop() {
+		circle.clone()
+	}
+}
+
+func BenchmarkDeepClone(b *testing.B) {
+	circle := benchmarkCircle()
+	for b.Loop() {
+		if _, err := DeepClone(circle); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
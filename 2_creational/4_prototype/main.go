@@ -1,16 +1,31 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
 
 // Prototype interface
 type Shape interface {
 	print()
 	clone() Shape
+	area() float64
+	perimeter() float64
+	bounds() Bounds
+	translate(dx, dy float64)
+	svg() string
 }
 
 // Concrete prototype
 type Circle struct {
-	color string
+	color  string
+	center Point
+	radius float64
+	style  Style
 }
 
 func (c *Circle) print() {
@@ -20,11 +35,29 @@ func (c *Circle) print() {
 
 func (c *Circle) clone() Shape {
 	fmt.Println("Cloning...")
-	return &Circle{color: c.color}
+	return &Circle{color: c.color, center: c.center, radius: c.radius, style: c.style.clone()}
 }
 
-func main() {
+func (c *Circle) area() float64 {
+	return math.Pi * c.radius * c.radius
+}
+
+func (c *Circle) perimeter() float64 {
+	return 2 * math.Pi * c.radius
+}
+
+func (c *Circle) bounds() Bounds {
+	return Bounds{
+		min: Point{c.center.x - c.radius, c.center.y - c.radius},
+		max: Point{c.center.x + c.radius, c.center.y + c.radius},
+	}
+}
 
+func (c *Circle) translate(dx, dy float64) {
+	c.center = c.center.add(dx, dy)
+}
+
+func main() {
 	greenCircle := &Circle{color: "Green"}
 	blueCircle := &Circle{color: "Blue"}
 	redCircle := &Circle{color: "Red"}
@@ -40,4 +73,121 @@ func main() {
 	blueClone.print()
 	redClone.print()
 
+	// Palette of named prototypes shared between goroutines
+	registry := newPrototypeRegistry()
+	registry.register("green", greenCircle)
+	registry.register("blue", blueCircle)
+	registry.register("red", redCircle)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"green", "blue", "red", "green"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := registry.clone(name); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	registry.unregister("red")
+	if _, err := registry.clone("red"); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("Palette:", registry.names())
+
+	// Geometry survives cloning and moves with translation
+	floorPlan := &Group{name: "Floor plan"}
+	floorPlan.add(&Rectangle{color: "Grey", position: Point{0, 0}, width: 10, height: 6})
+	floorPlan.add(&Circle{color: "Brown", center: Point{5, 3}, radius: 1})
+	floorPlan.add(&Polygon{color: "White", vertices: []Point{{10, 0}, {13, 0}, {10, 4}}})
+
+	nextFloor := floorPlan.clone()
+	nextFloor.translate(20, 0)
+	for _, plan := range []Shape{floorPlan, nextFloor} {
+		b := plan.bounds()
+		fmt.Printf("Area: %.2f Perimeter: %.2f Bounds: (%.1f, %.1f)-(%.1f, %.1f)\n",
+			plan.area(), plan.perimeter(), b.min.x, b.min.y, b.max.x, b.max.y)
+	}
+
+	// Render the original and the cloned floor as one drawing
+	writeSVGDocument(os.Stdout, []Shape{floorPlan, nextFloor})
+
+	// Reflection based deep copy of a whole group
+	reflected, err := DeepClone(floorPlan)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	reflected.children[0].(*Rectangle).style = Style{"stroke": "black"}
+	reflected.translate(0, 10)
+	fmt.Printf("Original bounds: %v Reflected bounds: %v\n", floorPlan.bounds(), reflected.bounds())
+
+	// Variants derived from presets in one step
+	registry.register("dot", &Circle{color: "Green", center: Point{1, 1}, radius: 1})
+	registry.register("floor plan", floorPlan)
+	bigRedCircle, err := registry.cloneWith("dot", WithColor("Red"), WithPosition(Point{5, 5}), WithScale(3))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(bigRedCircle.svg())
+	if _, err := registry.cloneWith("floor plan", WithColor("Blue")); err != nil {
+		fmt.Println(err)
+	}
+
+	// Palette survives a restart
+	paletteDir, err := os.MkdirTemp("", "palette")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(paletteDir)
+
+	palettePath := filepath.Join(paletteDir, "palette.json")
+	if err := registry.saveFile(palettePath); err != nil {
+		fmt.Println(err)
+		return
+	}
+	loaded := newPrototypeRegistry()
+	if err := loaded.loadFile(palettePath); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("Loaded palette:", loaded.names())
+	if err := loaded.load(strings.NewReader(`{"version": 1, "prototypes": {"star": {"type": "star"}}}`)); err != nil {
+		fmt.Println(err)
+	}
+
+	// Scene graph with a house duplicated in one operation
+	canvas := newSceneNode("canvas", nil)
+	house := newSceneNode("house", nil)
+	house.setPosition(10, 10)
+	house.setScale(2, 2)
+	canvas.addChild(house)
+
+	wall := newSceneNode("wall", &Rectangle{color: "Beige", width: 10, height: 8})
+	roof := newSceneNode("roof", &Polygon{color: "Brown", vertices: []Point{{-1, 0}, {11, 0}, {5, -5}}})
+	window := newSceneNode("window", &Circle{color: "Blue", center: Point{5, 4}, radius: 1.5})
+	house.addChild(wall)
+	house.addChild(roof)
+	house.addChild(window)
+
+	tiltedHouse := house.clone().(*SceneNode)
+	tiltedHouse.translate(40, 0)
+	tiltedHouse.setRotation(15)
+	canvas.addChild(tiltedHouse)
+	registry.register("house", tiltedHouse)
+
+	for _, p := range []Point{{20, 18}, {12, 12}, {20, 2}, {58, 20}, {0, 0}} {
+		if node := canvas.hitTest(p); node != nil {
+			fmt.Printf("Hit at (%g, %g): %s\n", p.x, p.y, node.name)
+		} else {
+			fmt.Printf("Hit at (%g, %g): nothing\n", p.x, p.y)
+		}
+	}
+	fmt.Println("Window world transform:", window.worldTransform())
+	canvas.print()
+	writeSVGDocument(os.Stdout, []Shape{canvas})
 }
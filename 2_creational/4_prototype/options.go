@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errOptionNotApplicable = errors.New("option does not apply to shape")
+
+// Override applied to a fresh clone by CloneWith
+type Option func(Shape) error
+
+type colorable interface {
+	setColor(color string)
+}
+
+type scalable interface {
+	scale(origin Point, factor float64) error
+}
+
+func (c *Circle) setColor(color string) {
+	c.color = color
+}
+
+func (r *Rectangle) setColor(color string) {
+	r.color = color
+}
+
+func (p *Polygon) setColor(color string) {
+	p.color = color
+}
+
+func scalePoint(p, origin Point, factor float64) Point {
+	return Point{origin.x + (p.x-origin.x)*factor, origin.y + (p.y-origin.y)*factor}
+}
+
+func (c *Circle) scale(origin Point, factor float64) error {
+	c.center = scalePoint(c.center, origin, factor)
+	c.radius *= factor
+	return nil
+}
+
+func (r *Rectangle) scale(origin Point, factor float64) error {
+	r.position = scalePoint(r.position, origin, factor)
+	r.width *= factor
+	r.height *= factor
+	return nil
+}
+
+func (p *Polygon) scale(origin Point, factor float64) error {
+	for i, v := range p.vertices {
+		p.vertices[i] = scalePoint(v, origin, factor)
+	}
+	return nil
+}
+
+func (g *Group) scale(origin Point, factor float64) error {
+	for _, child := range g.children {
+		s, ok := child.(scalable)
+		if !ok {
+			return fmt.Errorf("%w: scale on %T", errOptionNotApplicable, child)
+		}
+		if err := s.scale(origin, factor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Groups have no color of their own
+func WithColor(color string) Option {
+	return func(s Shape) error {
+		c, ok := s.(colorable)
+		if !ok {
+			return fmt.Errorf("%w: color on %T", errOptionNotApplicable, s)
+		}
+		c.setColor(color)
+		return nil
+	}
+}
+
+// Moves the shape so the top left of its bounding box is at p
+func WithPosition(p Point) Option {
+	return func(s Shape) error {
+		b := s.bounds()
+		s.translate(p.x-b.min.x, p.y-b.min.y)
+		return nil
+	}
+}
+
+// Scales the shape around the top left of its bounding box
+func WithScale(factor float64) Option {
+	return func(s Shape) error {
+		if factor <= 0 {
+			return fmt.Errorf("scale factor must be positive, got %g", factor)
+		}
+		sc, ok := s.(scalable)
+		if !ok {
+			return fmt.Errorf("%w: scale on %T", errOptionNotApplicable, s)
+		}
+		return sc.scale(s.bounds().min, factor)
+	}
+}
+
+// Clones the prototype and applies every option, returning no shape if any option fails
+func CloneWith(prototype Shape, opts ...Option) (Shape, error) {
+	clone := prototype.clone()
+	for _, opt := range opts {
+		if err := opt(clone); err != nil {
+			return nil, err
+		}
+	}
+	return clone, nil
+}
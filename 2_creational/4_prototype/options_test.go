@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func optionShapes() []Shape {
+	group := &Group{name: "Pair"}
+	group.add(&Circle{color: "Red", center: Point{3, 3}, radius: 1})
+	group.add(&Rectangle{color: "Blue", position: Point{4, 2}, width: 2, height: 4})
+	return []Shape{
+		&Circle{color: "Green", center: Point{2, 3}, radius: 1},
+		&Rectangle{color: "Grey", position: Point{1, 2}, width: 3, height: 4},
+		&Polygon{color: "White", vertices: []Point{{1, 2}, {5, 2}, {3, 5}}},
+		group,
+	}
+}
+
+func TestCloneWithPositionAndScale(t *testing.T) {
+	for _, prototype := range optionShapes() {
+		before := prototype.bounds()
+		width, height := before.max.x-before.min.x, before.max.y-before.min.y
+
+		moved, err := CloneWith(prototype, WithPosition(Point{10, 20}))
+		if err != nil {
+			t.Fatalf("%T: %v", prototype, err)
+		}
+		want := Bounds{min: Point{10, 20}, max: Point{10 + width, 20 + height}}
+		if got := moved.bounds(); got != want {
+			t.Errorf("%T moved: bounds = %v, want %v", prototype, got, want)
+		}
+
+		// Scaling keeps the top left corner in place
+		scaled, err := CloneWith(prototype, WithScale(2))
+		if err != nil {
+			t.Fatalf("%T: %v", prototype, err)
+		}
+		want = Bounds{min: before.min, max: Point{before.min.x + 2*width, before.min.y + 2*height}}
+		if got := scaled.bounds(); got != want {
+			t.Errorf("%T scaled: bounds = %v, want %v", prototype, got, want)
+		}
+
+		if got := prototype.bounds(); got != before {
+			t.Errorf("%T: prototype bounds changed to %v", prototype, got)
+		}
+	}
+}
+
+func TestCloneWithScaledFields(t *testing.T) {
+	shapes := optionShapes()
+
+	circle, _ := CloneWith(shapes[0], WithScale(3))
+	if c := circle.(*Circle); c.radius != 3 || c.center != (Point{4, 5}) {
+		t.Errorf("circle = center %v radius %g, want center {4 5} radius 3", c.center, c.radius)
+	}
+	rect, _ := CloneWith(shapes[1], WithScale(0.5), WithPosition(Point{0, 0}))
+	if r := rect.(*Rectangle); r.width != 1.5 || r.height != 2 || r.position != (Point{0, 0}) {
+		t.Errorf("rectangle = %v %gx%g, want {0 0} 1.5x2", r.position, r.width, r.height)
+	}
+}
+
+func TestCloneWithColor(t *testing.T) {
+	for _, prototype := range optionShapes()[:3] {
+		clone, err := CloneWith(prototype, WithColor("Purple"))
+		if err != nil {
+			t.Fatalf("%T: %v", prototype, err)
+		}
+		if !strings.Contains(clone.svg(), `fill="purple"`) {
+			t.Errorf("%T clone = %s, want a purple fill", prototype, clone.svg())
+		}
+	}
+
+	group := optionShapes()[3]
+	if _, err := CloneWith(group, WithColor("Purple")); !errors.Is(err, errOptionNotApplicable) {
+		t.Errorf("group: err = %v, want errOptionNotApplicable", err)
+	}
+}
+
+func TestWithScaleRejectsNonPositive(t *testing.T) {
+	for _, factor := range []float64{0, -1} {
+		if _, err := CloneWith(&Circle{radius: 1}, WithScale(factor)); err == nil {
+			t.Errorf("scale %g accepted", factor)
+		}
+	}
+}
+
+func TestCloneWithFailureLeavesPrototype(t *testing.T) {
+	group := optionShapes()[3].(*Group)
+	before := group.svg()
+
+	// Position applies to the clone, then the color fails on the group
+	clone, err := CloneWith(group, WithPosition(Point{50, 50}), WithScale(2), WithColor("Purple"))
+	if !errors.Is(err, errOptionNotApplicable) {
+		t.Fatalf("err = %v, want errOptionNotApplicable", err)
+	}
+	if clone != nil {
+		t.Errorf("got a partly applied clone %v", clone)
+	}
+	if got := group.svg(); got != before {
+		t.Errorf("prototype changed:\n%s\nwant:\n%s", got, before)
+	}
+}
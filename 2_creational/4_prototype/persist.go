@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Palette file format version, bumped on incompatible changes
+const paletteVersion = 1
+
+var errUnknownShapeType = errors.New("unknown shape type")
+
+type paletteJSON struct {
+	Version    int                  `json:"version"`
+	Prototypes map[string]shapeJSON `json:"prototypes"`
+}
+
+type pointJSON struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Every shape in one flat object, told apart by its type
+type shapeJSON struct {
+	Type     string      `json:"type"`
+	Name     string      `json:"name,omitempty"`
+	Color    string      `json:"color,omitempty"`
+	Center   *pointJSON  `json:"center,omitempty"`
+	Radius   float64     `json:"radius,omitempty"`
+	Position *pointJSON  `json:"position,omitempty"`
+	Width    float64     `json:"width,omitempty"`
+	Height   float64     `json:"height,omitempty"`
+	Vertices []pointJSON `json:"vertices,omitempty"`
+	Children []shapeJSON `json:"children,omitempty"`
+	Style    Style       `json:"style,omitempty"`
+	// Scene nodes only, the children above are nodes as well
+	Shape    *shapeJSON `json:"shape,omitempty"`
+	Rotation float64    `json:"rotation,omitempty"`
+	// Missing means 1 on both axes
+	Scale *pointJSON `json:"scale,omitempty"`
+}
+
+func toPointJSON(p Point) *pointJSON {
+	return &pointJSON{X: p.x, Y: p.y}
+}
+
+func fromPointJSON(p *pointJSON) Point {
+	if p == nil {
+		return Point{}
+	}
+	return Point{p.X, p.Y}
+}
+
+func encodeShape(s Shape) (shapeJSON, error) {
+	switch s := s.(type) {
+	case *Circle:
+		return shapeJSON{Type: "circle", Color: s.color, Center: toPointJSON(s.center), Radius: s.radius, Style: s.style}, nil
+	case *Rectangle:
+		return shapeJSON{Type: "rectangle", Color: s.color, Position: toPointJSON(s.position), Width: s.width, Height: s.height, Style: s.style}, nil
+	case *Polygon:
+		vertices := make([]pointJSON, len(s.vertices))
+		for i, v := range s.vertices {
+			vertices[i] = *toPointJSON(v)
+		}
+		return shapeJSON{Type: "polygon", Color: s.color, Vertices: vertices, Style: s.style}, nil
+	case *Group:
+		children := make([]shapeJSON, len(s.children))
+		for i, child := range s.children {
+			encoded, err := encodeShape(child)
+			if err != nil {
+				return shapeJSON{}, err
+			}
+			children[i] = encoded
+		}
+		return shapeJSON{Type: "group", Name: s.name, Children: children, Style: s.style}, nil
+	case *SceneNode:
+		data := shapeJSON{Type: "node", Name: s.name, Position: toPointJSON(s.position), Rotation: s.rotation}
+		if s.scaleX != 1 || s.scaleY != 1 {
+			data.Scale = &pointJSON{X: s.scaleX, Y: s.scaleY}
+		}
+		if s.shape != nil {
+			shape, err := encodeShape(s.shape)
+			if err != nil {
+				return shapeJSON{}, err
+			}
+			data.Shape = &shape
+		}
+		for _, child := range s.children {
+			encoded, err := encodeShape(child)
+			if err != nil {
+				return shapeJSON{}, err
+			}
+			data.Children = append(data.Children, encoded)
+		}
+		return data, nil
+	}
+	return shapeJSON{}, fmt.Errorf("%w: %T", errUnknownShapeType, s)
+}
+
+func decodeShape(data shapeJSON) (Shape, error) {
+	switch data.Type {
+	case "circle":
+		return &Circle{color: data.Color, center: fromPointJSON(data.Center), radius: data.Radius, style: data.Style}, nil
+	case "rectangle":
+		return &Rectangle{color: data.Color, position: fromPointJSON(data.Position), width: data.Width, height: data.Height, style: data.Style}, nil
+	case "polygon":
+		vertices := make([]Point, len(data.Vertices))
+		for i := range data.Vertices {
+			vertices[i] = fromPointJSON(&data.Vertices[i])
+		}
+		return &Polygon{color: data.Color, vertices: vertices, style: data.Style}, nil
+	case "group":
+		group := &Group{name: data.Name, style: data.Style}
+		for _, childData := range data.Children {
+			child, err := decodeShape(childData)
+			if err != nil {
+				return nil, err
+			}
+			group.add(child)
+		}
+		return group, nil
+	case "node":
+		node := newSceneNode(data.Name, nil)
+		node.position = fromPointJSON(data.Position)
+		node.rotation = data.Rotation
+		if data.Scale != nil {
+			node.scaleX, node.scaleY = data.Scale.X, data.Scale.Y
+		}
+		if data.Shape != nil {
+			shape, err := decodeShape(*data.Shape)
+			if err != nil {
+				return nil, err
+			}
+			node.shape = shape
+		}
+		for _, childData := range data.Children {
+			child, err := decodeShape(childData)
+			if err != nil {
+				return nil, err
+			}
+			childNode, ok := child.(*SceneNode)
+			if !ok {
+				return nil, fmt.Errorf("node %q: child of type %q is not a node", data.Name, childData.Type)
+			}
+			node.addChild(childNode)
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownShapeType, data.Type)
+}
+
+func (r *PrototypeRegistry) save(w io.Writer) error {
+	palette := paletteJSON{Version: paletteVersion, Prototypes: map[string]shapeJSON{}}
+
+	r.mu.RLock()
+	for name, prototype := range r.prototypes {
+		encoded, err := encodeShape(prototype)
+		if err != nil {
+			r.mu.RUnlock()
+			return fmt.Errorf("prototype %q: %w", name, err)
+		}
+		palette.Prototypes[name] = encoded
+	}
+	r.mu.RUnlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(palette)
+}
+
+// Adds every prototype in the palette, or none of them if any fails to decode
+func (r *PrototypeRegistry) load(rd io.Reader) error {
+	var palette paletteJSON
+	if err := json.NewDecoder(rd).Decode(&palette); err != nil {
+		return err
+	}
+	if palette.Version < 1 || palette.Version > paletteVersion {
+		return fmt.Errorf("unsupported palette version %d", palette.Version)
+	}
+
+	prototypes := make(map[string]Shape, len(palette.Prototypes))
+	for name, data := range palette.Prototypes {
+		prototype, err := decodeShape(data)
+		if err != nil {
+			return fmt.Errorf("prototype %q: %w", name, err)
+		}
+		prototypes[name] = prototype
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, prototype := range prototypes {
+		r.prototypes[name] = prototype
+	}
+	return nil
+}
+
+// Writes to a temporary file first so a failed save never leaves a truncated palette
+func (r *PrototypeRegistry) saveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := r.save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *PrototypeRegistry) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.load(f)
+}
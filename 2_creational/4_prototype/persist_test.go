@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func paletteShapes() map[string]Shape {
+	inner := &Group{name: "Window", style: Style{"stroke": "white"}}
+	inner.add(&Rectangle{color: "Blue", position: Point{1, 1}, width: 2, height: 2})
+	outer := &Group{name: "Wall", style: Style{"opacity": "0.8"}}
+	outer.add(&Rectangle{color: "Grey", width: 10, height: 6, style: Style{"stroke": "black", "stroke-width": "2"}})
+	outer.add(inner)
+
+	return map[string]Shape{
+		"dot":      &Circle{color: "Green", center: Point{1.5, -2}, radius: 0.5, style: Style{"fill": "green"}},
+		"brick":    &Rectangle{color: "Red", position: Point{3, 4}, width: 2, height: 1},
+		"triangle": &Polygon{color: "Yellow", vertices: []Point{{0, 0}, {4, 0}, {2, 3}}, style: Style{"stroke": "black"}},
+		"wall":     outer,
+	}
+}
+
+func TestPaletteRoundTrip(t *testing.T) {
+	registry := newPrototypeRegistry()
+	for name, shape := range paletteShapes() {
+		registry.register(name, shape)
+	}
+	path := filepath.Join(t.TempDir(), "palette.json")
+	if err := registry.saveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newPrototypeRegistry()
+	if err := loaded.loadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.names(), registry.names(); !slices.Equal(got, want) {
+		t.Fatalf("names = %v, want %v", got, want)
+	}
+	for name, want := range paletteShapes() {
+		got, err := loaded.clone(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestLoadRejectsVersions(t *testing.T) {
+	for _, version := range []int{0, paletteVersion + 1} {
+		palette := fmt.Sprintf(`{"version": %d, "prototypes": {}}`, version)
+		err := newPrototypeRegistry().load(strings.NewReader(palette))
+		if err == nil || !strings.Contains(err.Error(), "unsupported palette version") {
+			t.Errorf("version %d: err = %v, want unsupported version", version, err)
+		}
+	}
+}
+
+func TestLoadUnknownShapeType(t *testing.T) {
+	palette := `{"version": 1, "prototypes": {"star": {"type": "star"}}}`
+	err := newPrototypeRegistry().load(strings.NewReader(palette))
+	if !errors.Is(err, errUnknownShapeType) {
+		t.Errorf("err = %v, want errUnknownShapeType", err)
+	}
+
+	// Nested inside a group as well
+	palette = `{"version": 1, "prototypes": {"g": {"type": "group", "children": [{"type": "star"}]}}}`
+	if err := newPrototypeRegistry().load(strings.NewReader(palette)); !errors.Is(err, errUnknownShapeType) {
+		t.Errorf("nested: err = %v, want errUnknownShapeType", err)
+	}
+}
+
+func TestFailedLoadLeavesRegistry(t *testing.T) {
+	registry := newPrototypeRegistry()
+	registry.register("dot", &Circle{color: "Green", radius: 1})
+	var before bytes.Buffer
+	if err := registry.save(&before); err != nil {
+		t.Fatal(err)
+	}
+
+	palette := `{"version": 1, "prototypes": {
+		"dot": {"type": "circle", "color": "Red", "radius": 9},
+		"brick": {"type": "rectangle", "width": 2, "height": 1},
+		"star": {"type": "star"}
+	}}`
+	if err := registry.load(strings.NewReader(palette)); err == nil {
+		t.Fatal("load succeeded with an unknown shape")
+	}
+	if err := registry.load(strings.NewReader(`{"version": 1, "prototypes": `)); err == nil {
+		t.Fatal("load succeeded with truncated JSON")
+	}
+
+	var after bytes.Buffer
+	if err := registry.save(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after.String() != before.String() {
+		t.Errorf("registry changed:\n%s\nwant:\n%s", after.String(), before.String())
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var errUnknownPrototype = errors.New("unknown prototype")
+
+// Named palette of prototypes, safe for concurrent use
+type PrototypeRegistry struct {
+	mu         sync.RWMutex
+	prototypes map[string]Shape
+}
+
+func newPrototypeRegistry() *PrototypeRegistry {
+	return &PrototypeRegistry{
+		prototypes: map[string]Shape{},
+	}
+}
+
+// Stores a clone of the shape so later changes by the caller don't leak into the palette
+func (r *PrototypeRegistry) register(name string, prototype Shape) error {
+	if name == "" {
+		return errors.New("prototype name cannot be empty")
+	}
+	if prototype == nil {
+		return fmt.Errorf("prototype %q cannot be nil", name)
+	}
+
+	clone := prototype.clone()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prototypes[name] = clone
+	return nil
+}
+
+func (r *PrototypeRegistry) unregister(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.prototypes[name]; !ok {
+		return fmt.Errorf("%w: %q", errUnknownPrototype, name)
+	}
+	delete(r.prototypes, name)
+	return nil
+}
+
+// Returns a fresh clone of the named prototype
+func (r *PrototypeRegistry) clone(name string) (Shape, error) {
+	r.mu.RLock()
+	prototype, ok := r.prototypes[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownPrototype, name)
+	}
+	return prototype.clone(), nil
+}
+
+// Returns a clone of the named prototype with the options applied
+func (r *PrototypeRegistry) cloneWith(name string, opts ...Option) (Shape, error) {
+	r.mu.RLock()
+	prototype, ok := r.prototypes[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownPrototype, name)
+	}
+	return CloneWith(prototype, opts...)
+}
+
+func (r *PrototypeRegistry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.prototypes))
+}
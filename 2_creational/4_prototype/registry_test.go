@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestRegistryConcurrentAccess(t *testing.T) {
+	registry := newPrototypeRegistry()
+	registry.register("base", &Rectangle{color: "Gray", width: 1, height: 1})
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		name := fmt.Sprintf("shape%d", i)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if err := registry.register(name, &Circle{color: "Blue", radius: float64(i)}); err != nil {
+				t.Error(err)
+			}
+			// Only the registering goroutine removes its own odd names, so this cannot miss
+			if i%2 == 1 {
+				if err := registry.unregister(name); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := registry.clone("base"); err != nil {
+				t.Error(err)
+			}
+			// May run before or after the registration, either result is fine
+			if _, err := registry.cloneWith(name, WithColor("Red")); err != nil && !errors.Is(err, errUnknownPrototype) {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			registry.names()
+		}()
+	}
+	wg.Wait()
+
+	names := registry.names()
+	if len(names) != 26 || !slices.Contains(names, "shape48") || slices.Contains(names, "shape49") {
+		t.Errorf("names = %v, want base and the even shapes", names)
+	}
+}
+
+func TestRegistryUnknownNames(t *testing.T) {
+	registry := newPrototypeRegistry()
+	registry.register("dot", &Circle{color: "Green", radius: 1})
+
+	if _, err := registry.clone("missing"); !errors.Is(err, errUnknownPrototype) {
+		t.Errorf("clone: err = %v, want errUnknownPrototype", err)
+	}
+	if _, err := registry.cloneWith("missing", WithColor("Red")); !errors.Is(err, errUnknownPrototype) {
+		t.Errorf("cloneWith: err = %v, want errUnknownPrototype", err)
+	}
+	if err := registry.unregister("missing"); !errors.Is(err, errUnknownPrototype) {
+		t.Errorf("unregister: err = %v, want errUnknownPrototype", err)
+	}
+
+	if err := registry.unregister("dot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.clone("dot"); !errors.Is(err, errUnknownPrototype) {
+		t.Errorf("clone after unregister: err = %v, want errUnknownPrototype", err)
+	}
+	if err := registry.unregister("dot"); !errors.Is(err, errUnknownPrototype) {
+		t.Errorf("second unregister: err = %v, want errUnknownPrototype", err)
+	}
+}
+
+func TestRegistryRejectsInvalidPrototypes(t *testing.T) {
+	registry := newPrototypeRegistry()
+	if err := registry.register("", &Circle{}); err == nil {
+		t.Error("registered an empty name")
+	}
+	if err := registry.register("nil", nil); err == nil {
+		t.Error("registered a nil prototype")
+	}
+}
+
+func TestRegistryStoresAClone(t *testing.T) {
+	registry := newPrototypeRegistry()
+	dot := &Circle{color: "Green", radius: 1}
+	registry.register("dot", dot)
+	dot.color = "Red"
+
+	clone, err := registry.clone("dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := clone.(*Circle).color; got != "Green" {
+		t.Errorf("clone color = %s, want Green as registered", got)
+	}
+	if clone == Shape(dot) {
+		t.Error("clone returned the registered shape itself")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// 2D affine transform, x' = a*x + c*y + e and y' = b*x + d*y + f, as in SVG
+type Transform struct {
+	a, b, c, d, e, f float64
+}
+
+func identity() Transform {
+	return Transform{a: 1, d: 1}
+}
+
+func translation(dx, dy float64) Transform {
+	return Transform{a: 1, d: 1, e: dx, f: dy}
+}
+
+func rotation(degrees float64) Transform {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	return Transform{a: cos, b: sin, c: -sin, d: cos}
+}
+
+func scaling(sx, sy float64) Transform {
+	return Transform{a: sx, d: sy}
+}
+
+// Transform applying o first and then t
+func (t Transform) multiply(o Transform) Transform {
+	return Transform{
+		a: t.a*o.a + t.c*o.b,
+		b: t.b*o.a + t.d*o.b,
+		c: t.a*o.c + t.c*o.d,
+		d: t.b*o.c + t.d*o.d,
+		e: t.a*o.e + t.c*o.f + t.e,
+		f: t.b*o.e + t.d*o.f + t.f,
+	}
+}
+
+func (t Transform) apply(p Point) Point {
+	return Point{t.a*p.x + t.c*p.y + t.e, t.b*p.x + t.d*p.y + t.f}
+}
+
+func (t Transform) determinant() float64 {
+	return t.a*t.d - t.b*t.c
+}
+
+// Reports false when the transform collapses space and cannot be inverted
+func (t Transform) inverse() (Transform, bool) {
+	det := t.determinant()
+	if det == 0 {
+		return Transform{}, false
+	}
+	return Transform{
+		a: t.d / det,
+		b: -t.b / det,
+		c: -t.c / det,
+		d: t.a / det,
+		e: (t.c*t.f - t.d*t.e) / det,
+		f: (t.b*t.e - t.a*t.f) / det,
+	}, true
+}
+
+// Bounds of the transformed box, which grows to fit when rotated
+func (t Transform) applyBounds(b Bounds) Bounds {
+	corners := []Point{b.min, {b.max.x, b.min.y}, b.max, {b.min.x, b.max.y}}
+	first := t.apply(corners[0])
+	result := Bounds{min: first, max: first}
+	for _, corner := range corners[1:] {
+		p := t.apply(corner)
+		result = result.union(Bounds{min: p, max: p})
+	}
+	return result
+}
+
+// Shapes that can tell whether a point in their own space falls inside them
+type hittable interface {
+	contains(p Point) bool
+}
+
+func (c *Circle) contains(p Point) bool {
+	return c.center.distance(p) <= c.radius
+}
+
+func (r *Rectangle) contains(p Point) bool {
+	return p.x >= r.position.x && p.x <= r.position.x+r.width &&
+		p.y >= r.position.y && p.y <= r.position.y+r.height
+}
+
+// Ray casting
+func (p *Polygon) contains(q Point) bool {
+	inside := false
+	for i, a := range p.vertices {
+		b := p.vertices[(i+1)%len(p.vertices)]
+		if (a.y > q.y) != (b.y > q.y) && q.x < (b.x-a.x)*(q.y-a.y)/(b.y-a.y)+a.x {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func (g *Group) contains(p Point) bool {
+	for _, child := range g.children {
+		if h, ok := child.(hittable); ok && h.contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scene graph node, itself a Shape so a whole subtree can be registered as a prototype.
+// Shape methods work in the parent's space, with the node's local transform applied.
+type SceneNode struct {
+	name     string
+	shape    Shape
+	position Point
+	// Degrees, clockwise in SVG's y-down space
+	rotation float64
+	scaleX   float64
+	scaleY   float64
+	parent   *SceneNode
+	children []*SceneNode
+}
+
+func newSceneNode(name string, shape Shape) *SceneNode {
+	return &SceneNode{
+		name:   name,
+		shape:  shape,
+		scaleX: 1,
+		scaleY: 1,
+	}
+}
+
+func (n *SceneNode) setPosition(x, y float64) {
+	n.position = Point{x, y}
+}
+
+func (n *SceneNode) setRotation(degrees float64) {
+	n.rotation = degrees
+}
+
+func (n *SceneNode) setScale(sx, sy float64) {
+	n.scaleX, n.scaleY = sx, sy
+}
+
+var errSceneCycle = errors.New("scene node cannot be its own descendant")
+
+// Moves the child under this node, detaching it from its previous parent.
+// Fails when the child is this node or one of its ancestors, which would make a cycle.
+func (n *SceneNode) addChild(child *SceneNode) error {
+	for ancestor := n; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor == child {
+			return fmt.Errorf("%w: adding %s under %s", errSceneCycle, child.name, n.name)
+		}
+	}
+	if child.parent != nil {
+		child.parent.removeChild(child)
+	}
+	child.parent = n
+	n.children = append(n.children, child)
+	return nil
+}
+
+func (n *SceneNode) removeChild(child *SceneNode) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			child.parent = nil
+			return
+		}
+	}
+}
+
+// Scale, then rotate, then translate
+func (n *SceneNode) localTransform() Transform {
+	return translation(n.position.x, n.position.y).
+		multiply(rotation(n.rotation)).
+		multiply(scaling(n.scaleX, n.scaleY))
+}
+
+func (n *SceneNode) worldTransform() Transform {
+	if n.parent == nil {
+		return n.localTransform()
+	}
+	return n.parent.worldTransform().multiply(n.localTransform())
+}
+
+// Topmost node whose shape contains the point, given in the space of this node's parent
+func (n *SceneNode) hitTest(p Point) *SceneNode {
+	parentWorld := identity()
+	if n.parent != nil {
+		parentWorld = n.parent.worldTransform()
+	}
+	return n.hit(p, parentWorld)
+}
+
+func (n *SceneNode) hit(p Point, parentWorld Transform) *SceneNode {
+	world := parentWorld.multiply(n.localTransform())
+
+	// Later children are drawn on top, and children on top of the node's own shape
+	for i := len(n.children) - 1; i >= 0; i-- {
+		if found := n.children[i].hit(p, world); found != nil {
+			return found
+		}
+	}
+
+	h, ok := n.shape.(hittable)
+	if !ok {
+		return nil
+	}
+	inverse, ok := world.inverse()
+	if ok && h.contains(inverse.apply(p)) {
+		return n
+	}
+	return nil
+}
+
+func (n *SceneNode) contains(p Point) bool {
+	return n.hit(p, identity()) != nil
+}
+
+func (n *SceneNode) print() {
+	n.printIndented(0)
+}
+
+func (n *SceneNode) printIndented(depth int) {
+	fmt.Printf("%sNode %s at (%g, %g)", strings.Repeat("  ", depth), n.name, n.position.x, n.position.y)
+	if n.shape != nil {
+		fmt.Print(": ")
+		n.shape.print()
+	} else {
+		fmt.Println()
+	}
+	for _, child := range n.children {
+		child.printIndented(depth + 1)
+	}
+}
+
+// Copies the whole subtree, detached from any parent
+func (n *SceneNode) clone() Shape {
+	clone := &SceneNode{
+		name:     n.name,
+		position: n.position,
+		rotation: n.rotation,
+		scaleX:   n.scaleX,
+		scaleY:   n.scaleY,
+	}
+	if n.shape != nil {
+		clone.shape = n.shape.clone()
+	}
+	for _, child := range n.children {
+		clone.addChild(child.clone().(*SceneNode))
+	}
+	return clone
+}
+
+func (n *SceneNode) area() float64 {
+	var sum float64
+	if n.shape != nil {
+		sum += n.shape.area()
+	}
+	for _, child := range n.children {
+		sum += child.area()
+	}
+	return sum * math.Abs(n.localTransform().determinant())
+}
+
+// Exact for uniform scaling, an approximation otherwise
+func (n *SceneNode) perimeter() float64 {
+	var sum float64
+	if n.shape != nil {
+		sum += n.shape.perimeter()
+	}
+	for _, child := range n.children {
+		sum += child.perimeter()
+	}
+	return sum * math.Sqrt(math.Abs(n.localTransform().determinant()))
+}
+
+func (n *SceneNode) bounds() Bounds {
+	var b Bounds
+	found := false
+	if n.shape != nil {
+		b, found = n.shape.bounds(), true
+	}
+	for _, child := range n.children {
+		if !found {
+			b, found = child.bounds(), true
+			continue
+		}
+		b = b.union(child.bounds())
+	}
+	if !found {
+		return Bounds{min: n.position, max: n.position}
+	}
+	return n.localTransform().applyBounds(b)
+}
+
+func (n *SceneNode) translate(dx, dy float64) {
+	n.position = n.position.add(dx, dy)
+}
+
+func (n *SceneNode) scale(origin Point, factor float64) error {
+	n.position = scalePoint(n.position, origin, factor)
+	n.scaleX *= factor
+	n.scaleY *= factor
+	return nil
+}
+
+func (n *SceneNode) svg() string {
+	t := n.localTransform()
+	var b strings.Builder
+	fmt.Fprintf(&b, `<g data-name="%s" transform="matrix(%g %g %g %g %g %g)">`, html.EscapeString(n.name), t.a, t.b, t.c, t.d, t.e, t.f)
+	if n.shape != nil {
+		b.WriteString("\n  ")
+		b.WriteString(strings.ReplaceAll(n.shape.svg(), "\n", "\n  "))
+	}
+	for _, child := range n.children {
+		b.WriteString("\n  ")
+		b.WriteString(strings.ReplaceAll(child.svg(), "\n", "\n  "))
+	}
+	b.WriteString("\n</g>")
+	return b.String()
+}
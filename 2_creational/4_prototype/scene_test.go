@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newHouse() *SceneNode {
+	house := newSceneNode("house", nil)
+	house.setPosition(10, 10)
+	house.setRotation(15)
+	house.setScale(2, 2)
+	house.addChild(newSceneNode("wall", &Rectangle{color: "Beige", width: 10, height: 8}))
+	house.addChild(newSceneNode("window", &Circle{color: "Blue", center: Point{5, 4}, radius: 1.5}))
+	return house
+}
+
+func TestAddChildRejectsCycles(t *testing.T) {
+	root := newSceneNode("root", nil)
+	child := newSceneNode("child", nil)
+	grandchild := newSceneNode("grandchild", nil)
+	root.addChild(child)
+	child.addChild(grandchild)
+
+	for _, tt := range []struct{ parent, child *SceneNode }{
+		{root, root},
+		{grandchild, root},
+		{grandchild, child},
+	} {
+		if err := tt.parent.addChild(tt.child); !errors.Is(err, errSceneCycle) {
+			t.Errorf("adding %s under %s: err = %v, want errSceneCycle", tt.child.name, tt.parent.name, err)
+		}
+	}
+	if child.parent != root || grandchild.parent != child || len(root.children) != 1 {
+		t.Error("a rejected addChild changed the tree")
+	}
+}
+
+func TestSceneNodeSaveLoad(t *testing.T) {
+	registry := newPrototypeRegistry()
+	registry.register("house", newHouse())
+
+	var buf bytes.Buffer
+	if err := registry.save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newPrototypeRegistry()
+	if err := loaded.load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	shape, err := loaded.clone("house")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	house := shape.(*SceneNode)
+	original := newHouse()
+	if house.svg() != original.svg() {
+		t.Errorf("loaded scene differs\ngot:\n%s\nwant:\n%s", house.svg(), original.svg())
+	}
+	for _, child := range house.children {
+		if child.parent != house {
+			t.Errorf("%s not attached to the loaded node", child.name)
+		}
+	}
+}
+
+func TestSceneNodeDefaultScaleOmitted(t *testing.T) {
+	data, err := encodeShape(newSceneNode("empty", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Scale != nil {
+		t.Errorf("scale = %v, want it omitted", data.Scale)
+	}
+	decoded, err := decodeShape(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node := decoded.(*SceneNode); node.scaleX != 1 || node.scaleY != 1 {
+		t.Errorf("scale = %g, %g, want 1, 1", node.scaleX, node.scaleY)
+	}
+}
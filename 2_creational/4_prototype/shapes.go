@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+type Point struct {
+	x, y float64
+}
+
+func (p Point) add(dx, dy float64) Point {
+	return Point{p.x + dx, p.y + dy}
+}
+
+func (p Point) distance(q Point) float64 {
+	return math.Hypot(q.x-p.x, q.y-p.y)
+}
+
+// Axis aligned bounding box
+type Bounds struct {
+	min, max Point
+}
+
+func (b Bounds) union(o Bounds) Bounds {
+	return Bounds{
+		min: Point{math.Min(b.min.x, o.min.x), math.Min(b.min.y, o.min.y)},
+		max: Point{math.Max(b.max.x, o.max.x), math.Max(b.max.y, o.max.y)},
+	}
+}
+
+// Presentation attributes such as stroke or fill
+type Style map[string]string
+
+func (s Style) clone() Style {
+	if s == nil {
+		return nil
+	}
+	return maps.Clone(s)
+}
+
+// Concrete prototype positioned by its top left corner
+type Rectangle struct {
+	color    string
+	position Point
+	width    float64
+	height   float64
+	style    Style
+}
+
+func (r *Rectangle) print() {
+	fmt.Printf("%s rectangle %gx%g\n", r.color, r.width, r.height)
+}
+
+func (r *Rectangle) clone() Shape {
+	return &Rectangle{
+		color:    r.color,
+		position: r.position,
+		width:    r.width,
+		height:   r.height,
+		style:    r.style.clone(),
+	}
+}
+
+func (r *Rectangle) area() float64 {
+	return r.width * r.height
+}
+
+func (r *Rectangle) perimeter() float64 {
+	return 2 * (r.width + r.height)
+}
+
+func (r *Rectangle) bounds() Bounds {
+	return Bounds{min: r.position, max: r.position.add(r.width, r.height)}
+}
+
+func (r *Rectangle) translate(dx, dy float64) {
+	r.position = r.position.add(dx, dy)
+}
+
+// Concrete prototype with a closed list of vertices
+type Polygon struct {
+	color    string
+	vertices []Point
+	style    Style
+}
+
+func (p *Polygon) print() {
+	fmt.Printf("%s polygon with %d points\n", p.color, len(p.vertices))
+}
+
+func (p *Polygon) clone() Shape {
+	return &Polygon{
+		color:    p.color,
+		vertices: slices.Clone(p.vertices),
+		style:    p.style.clone(),
+	}
+}
+
+// Shoelace formula
+func (p *Polygon) area() float64 {
+	var sum float64
+	for i, a := range p.vertices {
+		b := p.vertices[(i+1)%len(p.vertices)]
+		sum += a.x*b.y - b.x*a.y
+	}
+	return math.Abs(sum) / 2
+}
+
+func (p *Polygon) perimeter() float64 {
+	if len(p.vertices) < 2 {
+		return 0
+	}
+	var sum float64
+	for i, a := range p.vertices {
+		sum += a.distance(p.vertices[(i+1)%len(p.vertices)])
+	}
+	return sum
+}
+
+func (p *Polygon) bounds() Bounds {
+	if len(p.vertices) == 0 {
+		return Bounds{}
+	}
+	b := Bounds{min: p.vertices[0], max: p.vertices[0]}
+	for _, v := range p.vertices[1:] {
+		b = b.union(Bounds{min: v, max: v})
+	}
+	return b
+}
+
+func (p *Polygon) translate(dx, dy float64) {
+	for i, v := range p.vertices {
+		p.vertices[i] = v.add(dx, dy)
+	}
+}
+
+// Concrete prototype holding other shapes, cloned child by child
+type Group struct {
+	name     string
+	children []Shape
+	style    Style
+}
+
+func (g *Group) print() {
+	fmt.Printf("Group %s:\n", g.name)
+	for _, child := range g.children {
+		child.print()
+	}
+}
+
+func (g *Group) clone() Shape {
+	children := make([]Shape, len(g.children))
+	for i, child := range g.children {
+		children[i] = child.clone()
+	}
+	return &Group{
+		name:     g.name,
+		children: children,
+		style:    g.style.clone(),
+	}
+}
+
+// Sum of the children, overlaps are counted twice
+func (g *Group) area() float64 {
+	var sum float64
+	for _, child := range g.children {
+		sum += child.area()
+	}
+	return sum
+}
+
+func (g *Group) perimeter() float64 {
+	var sum float64
+	for _, child := range g.children {
+		sum += child.perimeter()
+	}
+	return sum
+}
+
+// Children with nothing to draw are skipped, their zero box would stretch the group to the origin
+func (g *Group) bounds() Bounds {
+	var b Bounds
+	found := false
+	for _, child := range g.children {
+		if isEmpty(child) {
+			continue
+		}
+		if !found {
+			b, found = child.bounds(), true
+			continue
+		}
+		b = b.union(child.bounds())
+	}
+	return b
+}
+
+// Whether the shape has nothing to draw, such as a group without children
+func isEmpty(s Shape) bool {
+	switch s := s.(type) {
+	case *Polygon:
+		return len(s.vertices) == 0
+	case *Group:
+		return !slices.ContainsFunc(s.children, func(child Shape) bool { return !isEmpty(child) })
+	}
+	return false
+}
+
+func (g *Group) translate(dx, dy float64) {
+	for _, child := range g.children {
+		child.translate(dx, dy)
+	}
+}
+
+func (g *Group) add(s Shape) {
+	g.children = append(g.children, s)
+}
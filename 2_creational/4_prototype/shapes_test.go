@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func newDrawing() (*Group, *Circle, *Polygon) {
+	circle := &Circle{color: "Green", style: Style{"fill": "green"}}
+	triangle := &Polygon{
+		color:    "Yellow",
+		vertices: []Point{{0, 0}, {4, 0}, {2, 3}},
+		style:    Style{"stroke": "black"},
+	}
+	drawing := &Group{name: "Drawing", style: Style{"opacity": "1"}}
+	drawing.add(circle)
+	drawing.add(triangle)
+	return drawing, circle, triangle
+}
+
+func TestGroupCloneSharesNoState(t *testing.T) {
+	drawing, circle, triangle := newDrawing()
+	clone := drawing.clone().(*Group)
+
+	clone.style["opacity"] = "0.5"
+	clone.children[0].(*Circle).style["fill"] = "red"
+	cloneTriangle := clone.children[1].(*Polygon)
+	cloneTriangle.vertices[0] = Point{10, 10}
+	cloneTriangle.style["stroke"] = "white"
+	clone.add(&Circle{color: "Blue"})
+
+	if got := drawing.style["opacity"]; got != "1" {
+		t.Errorf("original opacity = %q, want 1", got)
+	}
+	if got := circle.style["fill"]; got != "green" {
+		t.Errorf("original circle fill = %q, want green", got)
+	}
+	if got := triangle.style["stroke"]; got != "black" {
+		t.Errorf("original triangle stroke = %q, want black", got)
+	}
+	if want := []Point{{0, 0}, {4, 0}, {2, 3}}; !slices.Equal(triangle.vertices, want) {
+		t.Errorf("original vertices = %v, want %v", triangle.vertices, want)
+	}
+	if len(drawing.children) != 2 {
+		t.Errorf("original has %d children, want 2", len(drawing.children))
+	}
+	if clone.children[0] == drawing.children[0] || clone.children[1] == drawing.children[1] {
+		t.Error("clone shares children with the original")
+	}
+}
+
+func TestOriginalChangesDoNotReachClone(t *testing.T) {
+	drawing, circle, triangle := newDrawing()
+	clone := drawing.clone().(*Group)
+
+	circle.style["fill"] = "purple"
+	triangle.vertices[1] = Point{8, 0}
+	// Appending within capacity must not show up in the clone either
+	triangle.vertices = append(triangle.vertices[:2], Point{5, 5})
+	drawing.children = drawing.children[:1]
+
+	cloneTriangle := clone.children[1].(*Polygon)
+	if got := clone.children[0].(*Circle).style["fill"]; got != "green" {
+		t.Errorf("clone circle fill = %q, want green", got)
+	}
+	if want := []Point{{0, 0}, {4, 0}, {2, 3}}; !slices.Equal(cloneTriangle.vertices, want) {
+		t.Errorf("clone vertices = %v, want %v", cloneTriangle.vertices, want)
+	}
+	if len(clone.children) != 2 {
+		t.Errorf("clone has %d children, want 2", len(clone.children))
+	}
+}
+
+func TestTranslatedCloneLeavesOriginal(t *testing.T) {
+	plan := &Group{name: "Floor plan"}
+	plan.add(&Rectangle{color: "Grey", width: 10, height: 6})
+	plan.add(&Polygon{color: "White", vertices: []Point{{10, 0}, {13, 0}, {10, 4}}})
+
+	clone := plan.clone()
+	clone.translate(20, 0)
+
+	if got, want := plan.bounds(), (Bounds{max: Point{13, 6}}); got != want {
+		t.Errorf("original bounds = %v, want %v", got, want)
+	}
+	if got, want := clone.bounds(), (Bounds{min: Point{20, 0}, max: Point{33, 6}}); got != want {
+		t.Errorf("clone bounds = %v, want %v", got, want)
+	}
+	if plan.area() != clone.area() || plan.perimeter() != clone.perimeter() {
+		t.Error("translation changed area or perimeter")
+	}
+}
+
+func TestGroupBoundsSkipsEmptyChildren(t *testing.T) {
+	group := &Group{name: "Outer"}
+	group.add(&Group{name: "Empty"})
+	group.add(&Rectangle{position: Point{10, 10}, width: 2, height: 3})
+	group.add(&Polygon{})
+
+	want := Bounds{min: Point{10, 10}, max: Point{12, 13}}
+	if got := group.bounds(); got != want {
+		t.Errorf("bounds = %v, want %v", got, want)
+	}
+	if got := (&Group{}).bounds(); got != (Bounds{}) {
+		t.Errorf("empty group bounds = %v, want zero", got)
+	}
+}
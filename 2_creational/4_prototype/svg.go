@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Fill from the shape's color followed by its style, in key order so output is stable.
+// A fill in the style overrides the color, an attribute may only appear once.
+func svgAttributes(color string, style Style) string {
+	var b strings.Builder
+	fill, ok := style["fill"]
+	if !ok {
+		fill = strings.ToLower(color)
+	}
+	if fill != "" {
+		fmt.Fprintf(&b, ` fill="%s"`, html.EscapeString(fill))
+	}
+	for _, key := range slices.Sorted(maps.Keys(style)) {
+		if key == "fill" {
+			continue
+		}
+		fmt.Fprintf(&b, ` %s="%s"`, html.EscapeString(key), html.EscapeString(style[key]))
+	}
+	return b.String()
+}
+
+func (c *Circle) svg() string {
+	return fmt.Sprintf(`<circle cx="%g" cy="%g" r="%g"%s/>`,
+		c.center.x, c.center.y, c.radius, svgAttributes(c.color, c.style))
+}
+
+func (r *Rectangle) svg() string {
+	return fmt.Sprintf(`<rect x="%g" y="%g" width="%g" height="%g"%s/>`,
+		r.position.x, r.position.y, r.width, r.height, svgAttributes(r.color, r.style))
+}
+
+func (p *Polygon) svg() string {
+	points := make([]string, len(p.vertices))
+	for i, v := range p.vertices {
+		points[i] = fmt.Sprintf("%g,%g", v.x, v.y)
+	}
+	return fmt.Sprintf(`<polygon points="%s"%s/>`,
+		strings.Join(points, " "), svgAttributes(p.color, p.style))
+}
+
+func (g *Group) svg() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<g data-name="%s"%s>`, html.EscapeString(g.name), svgAttributes("", g.style))
+	for _, child := range g.children {
+		b.WriteString("\n  ")
+		b.WriteString(strings.ReplaceAll(child.svg(), "\n", "\n  "))
+	}
+	b.WriteString("\n</g>")
+	return b.String()
+}
+
+// Full SVG document sized to fit every shape
+func writeSVGDocument(w io.Writer, shapes []Shape) error {
+	var box Bounds
+	for i, s := range shapes {
+		if i == 0 {
+			box = s.bounds()
+			continue
+		}
+		box = box.union(s.bounds())
+	}
+	width, height := box.max.x-box.min.x, box.max.y-box.min.y
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="%g %g %g %g">`,
+		width, height, box.min.x, box.min.y, width, height)
+	for _, s := range shapes {
+		b.WriteString("\n  ")
+		b.WriteString(strings.ReplaceAll(s.svg(), "\n", "\n  "))
+	}
+	b.WriteString("\n</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
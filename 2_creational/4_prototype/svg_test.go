@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Compares got with testdata/<name>.golden, rewriting the file with -update
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from %s\ngot:\n%s\nwant:\n%s", name, path, got, want)
+	}
+}
+
+func renderDocument(t *testing.T, shapes ...Shape) string {
+	t.Helper()
+	var b strings.Builder
+	if err := writeSVGDocument(&b, shapes); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func newFloorPlan() *Group {
+	plan := &Group{name: "Floor plan", style: Style{"stroke": "black"}}
+	plan.add(&Rectangle{color: "Grey", width: 10, height: 6})
+	plan.add(&Circle{color: "Brown", center: Point{5, 3}, radius: 1, style: Style{"stroke-width": "0.5"}})
+	plan.add(&Polygon{color: "White", vertices: []Point{{10, 0}, {13, 0}, {10, 4}}})
+	return plan
+}
+
+func TestSVGGolden(t *testing.T) {
+	nextFloor := newFloorPlan().clone()
+	nextFloor.translate(20, 0)
+
+	tests := []struct {
+		name   string
+		shapes []Shape
+	}{
+		{"single_shape", []Shape{&Circle{color: "Red", center: Point{2, 2}, radius: 2, style: Style{"stroke": "black"}}}},
+		{"group", []Shape{newFloorPlan()}},
+		{"cloned_group", []Shape{newFloorPlan(), nextFloor}},
+		{"empty", nil},
+		{"style_fill", []Shape{
+			&Circle{color: "Green", center: Point{2, 2}, radius: 2, style: Style{"fill": "green"}},
+			&Rectangle{color: "Blue", position: Point{4, 0}, width: 3, height: 2, style: Style{"fill": "#00f", "stroke": "black"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGolden(t, tt.name, renderDocument(t, tt.shapes...))
+		})
+	}
+}
+
+func TestSVGEscapesAttributes(t *testing.T) {
+	group := &Group{name: `"A" & <B>`, style: Style{"data-note": "<x>"}}
+	got := group.svg()
+	for _, want := range []string{`data-name="&#34;A&#34; &amp; &lt;B&gt;"`, `data-note="&lt;x&gt;"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("svg = %s, want it to contain %s", got, want)
+		}
+	}
+}
+
+func TestSVGStyleFillOverridesColor(t *testing.T) {
+	got := (&Circle{color: "Green", style: Style{"fill": "lime", "stroke": "black"}}).svg()
+	if n := strings.Count(got, "fill="); n != 1 {
+		t.Fatalf("svg = %s, has %d fill attributes", got, n)
+	}
+	if !strings.Contains(got, `fill="lime"`) {
+		t.Errorf("svg = %s, want the style fill", got)
+	}
+}
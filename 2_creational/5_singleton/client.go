@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errClientClosed = errors.New("client is closed")
+
+// Client for Server, safe for concurrent use. Requests share one connection
+// and are sent one at a time.
+type Client struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *respWriter
+	// Set after an I/O error, when the connection may be mid reply
+	err error
+}
+
+func dialClient(ctx context.Context, addr string) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: newRESPWriter(conn),
+	}, nil
+}
+
+// Sends one command and reads its reply. An error reply is returned as a respError.
+func (c *Client) do(ctx context.Context, args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	// Cancelling ctx fails the pending read or write, the connection is unusable after
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c.writer.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.writer.writeBulk(arg)
+	}
+	value, err := c.roundTrip()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		c.err = fmt.Errorf("connection failed: %w", err)
+		c.conn.Close()
+		return nil, err
+	}
+	if e, ok := value.(respError); ok {
+		return nil, e
+	}
+	return value, nil
+}
+
+func (c *Client) roundTrip() (any, error) {
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return readValue(c.reader)
+}
+
+func unexpectedReply(value any) error {
+	return fmt.Errorf("%w: unexpected reply %#v", errProtocol, value)
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	value, err := c.do(ctx, "PING")
+	if err != nil {
+		return err
+	}
+	if value != "PONG" {
+		return unexpectedReply(value)
+	}
+	return nil
+}
+
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := c.do(ctx, "GET", key)
+	if err != nil || value == nil {
+		return "", false, err
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", false, unexpectedReply(value)
+	}
+	return s, true, nil
+}
+
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	_, err := c.do(ctx, "SET", key, value)
+	return err
+}
+
+// Millisecond precision, shorter TTLs are rounded up
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	ms := (ttl + time.Millisecond - 1) / time.Millisecond
+	_, err := c.do(ctx, "SET", key, value, "PX", strconv.FormatInt(int64(ms), 10))
+	return err
+}
+
+// Number of keys that existed
+func (c *Client) Delete(ctx context.Context, keys ...string) (int, error) {
+	value, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return 0, unexpectedReply(value)
+	}
+	return int(n), nil
+}
+
+// Second precision as in Redis, partial seconds are rounded up so a short TTL
+// does not delete the key. Reports whether the key exists.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	seconds := ttl / time.Second
+	if ttl > 0 && ttl%time.Second != 0 {
+		seconds++
+	}
+	value, err := c.do(ctx, "EXPIRE", key, strconv.FormatInt(int64(seconds), 10))
+	if err != nil {
+		return false, err
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return false, unexpectedReply(value)
+	}
+	return n == 1, nil
+}
+
+// Keys matching a glob pattern, "*" for all of them
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	value, err := c.do(ctx, "KEYS", pattern)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, unexpectedReply(value)
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		if keys[i], ok = item.(string); !ok {
+			return nil, unexpectedReply(value)
+		}
+	}
+	return keys, nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		// Already closed, after a failure the connection was closed with it
+		c.err = errClientClosed
+		return nil
+	}
+	c.err = errClientClosed
+	return c.conn.Close()
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// Why a key left the database without being deleted
+type EvictionReason int
+
+const (
+	EvictionCapacity EvictionReason = iota
+	EvictionExpired
+)
+
+func (r EvictionReason) String() string {
+	if r == EvictionExpired {
+		return "expired"
+	}
+	return "capacity"
+}
+
+type eviction struct {
+	key    string
+	value  string
+	reason EvictionReason
+}
+
+// Decides which key to evict when the database is full
+type EvictionPolicy interface {
+	added(key string)
+	accessed(key string)
+	removed(key string)
+	victim() (string, bool)
+}
+
+// Least recently used
+type lruPolicy struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{order: list.New(), elements: map[string]*list.Element{}}
+}
+
+func (p *lruPolicy) added(key string) {
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) accessed(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) removed(key string) {
+	if e, ok := p.elements[key]; ok {
+		p.order.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	if back := p.order.Back(); back != nil {
+		return back.Value.(string), true
+	}
+	return "", false
+}
+
+// First in, first out, access does not matter
+type fifoPolicy struct {
+	lruPolicy
+}
+
+func newFIFOPolicy() *fifoPolicy {
+	return &fifoPolicy{lruPolicy: *newLRUPolicy()}
+}
+
+func (p *fifoPolicy) accessed(key string) {}
+
+// Least frequently used, the oldest key wins a tie
+type lfuPolicy struct {
+	seq     int
+	entries map[string]*lfuEntry
+}
+
+type lfuEntry struct {
+	count int
+	seq   int
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{entries: map[string]*lfuEntry{}}
+}
+
+func (p *lfuPolicy) added(key string) {
+	p.seq++
+	p.entries[key] = &lfuEntry{count: 1, seq: p.seq}
+}
+
+func (p *lfuPolicy) accessed(key string) {
+	if e, ok := p.entries[key]; ok {
+		e.count++
+	}
+}
+
+func (p *lfuPolicy) removed(key string) {
+	delete(p.entries, key)
+}
+
+// Linear scan, fine for the sizes a CLI cache holds
+func (p *lfuPolicy) victim() (string, bool) {
+	var victim string
+	var best *lfuEntry
+	for key, e := range p.entries {
+		if best == nil || e.count < best.count || (e.count == best.count && e.seq < best.seq) {
+			victim, best = key, e
+		}
+	}
+	return victim, best != nil
+}
+
+var errNoEvictionPolicy = errors.New("eviction policy is nil")
+
+// Caps the number of keys, evicting with policy once full. A maxKeys of zero
+// or less means no limit. Keys already over the limit are evicted right away;
+// existing keys are handed to policy in sorted order, so they are evicted
+// in that order when none has been used since.
+func (d *Database) setEviction(maxKeys int, policy EvictionPolicy) error {
+	if policy == nil {
+		return errNoEvictionPolicy
+	}
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.maxKeys = maxKeys
+	d.policy = policy
+	for _, key := range slices.Sorted(maps.Keys(d.data)) {
+		policy.added(key)
+	}
+	for maxKeys > 0 && len(d.data) > maxKeys {
+		victim, ok := policy.victim()
+		if !ok {
+			break
+		}
+		before := len(d.data)
+		if evicted = d.removeLocked(victim, EvictionCapacity, evicted); len(d.data) == before {
+			break
+		}
+	}
+	return nil
+}
+
+// Called outside the database lock, so it may use the database
+func (d *Database) setEvictionCallback(fn func(key, value string, reason EvictionReason)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onEvict = fn
+}
+
+func (d *Database) notifyEvicted(evicted []eviction) {
+	if len(evicted) == 0 {
+		return
+	}
+	d.mu.RLock()
+	onEvict := d.onEvict
+	d.mu.RUnlock()
+	if onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		onEvict(e.key, e.value, e.reason)
+	}
+}
+
+func (d *Database) expiredLocked(key string, now time.Time) bool {
+	deadline, ok := d.expires[key]
+	return ok && !now.Before(deadline)
+}
+
+// Removes the key, recording it for the eviction callback. Callers hold d.mu.
+func (d *Database) removeLocked(key string, reason EvictionReason, evicted []eviction) []eviction {
+	value, ok := d.data[key]
+	if !ok || d.commitLocked(record{op: opDelete, key: key}) != nil {
+		return evicted
+	}
+	return append(evicted, eviction{key: key, value: value, reason: reason})
+}
+
+func (d *Database) removeExpiredLocked(now time.Time, evicted []eviction) []eviction {
+	for key := range d.expires {
+		if d.expiredLocked(key, now) {
+			evicted = d.removeLocked(key, EvictionExpired, evicted)
+		}
+	}
+	return evicted
+}
+
+// Frees a slot before a new key is added, dropping expired keys before live ones.
+// Callers hold d.mu.
+func (d *Database) makeRoomLocked(key string, evicted []eviction) []eviction {
+	if _, ok := d.data[key]; ok {
+		return evicted
+	}
+	return d.makeRoomForLocked(1, evicted)
+}
+
+// Frees enough slots for n new keys. Callers hold d.mu.
+func (d *Database) makeRoomForLocked(n int, evicted []eviction) []eviction {
+	if d.maxKeys <= 0 || d.policy == nil || n <= 0 {
+		return evicted
+	}
+	if len(d.data)+n > d.maxKeys {
+		evicted = d.removeExpiredLocked(time.Now(), evicted)
+	}
+	for len(d.data)+n > d.maxKeys {
+		victim, ok := d.policy.victim()
+		if !ok {
+			break
+		}
+		before := len(d.data)
+		if evicted = d.removeLocked(victim, EvictionCapacity, evicted); len(d.data) == before {
+			break
+		}
+	}
+	return evicted
+}
+
+var errTTLTooLong = errors.New("ttl ends after the latest deadline the log can store")
+
+// Deadlines are logged in Unix nanoseconds, which run out in 2262
+var maxDeadline = time.Unix(0, math.MaxInt64)
+
+func deadlineAfter(now time.Time, ttl time.Duration) (time.Time, error) {
+	deadline := now.Add(ttl)
+	if deadline.After(maxDeadline) {
+		return time.Time{}, errTTLTooLong
+	}
+	return deadline, nil
+}
+
+func (d *Database) SetWithTTL(key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	deadline, err := deadlineAfter(time.Now(), ttl)
+	if err != nil {
+		return err
+	}
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted = d.makeRoomLocked(key, evicted)
+	return d.commitLocked(
+		record{op: opSet, key: key, value: value},
+		expireRecord(key, deadline),
+	)
+}
+
+// Sets a TTL on an existing key, reporting whether the key exists
+func (d *Database) Expire(key string, ttl time.Duration) (bool, error) {
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if d.expiredLocked(key, now) {
+		evicted = d.removeLocked(key, EvictionExpired, evicted)
+		return false, nil
+	}
+	if _, ok := d.data[key]; !ok {
+		return false, nil
+	}
+	if ttl <= 0 {
+		evicted = d.removeLocked(key, EvictionExpired, evicted)
+		return true, nil
+	}
+	deadline, err := deadlineAfter(now, ttl)
+	if err != nil {
+		return false, err
+	}
+	if err := d.commitLocked(expireRecord(key, deadline)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Time left before the key expires, false when it has no TTL or does not exist
+func (d *Database) TTL(key string) (time.Duration, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	deadline, ok := d.expires[key]
+	if !ok {
+		return 0, false
+	}
+	return max(time.Until(deadline), 0), true
+}
+
+// Removes expired keys every interval, on top of the lazy expiry done on access
+func (d *Database) startBackgroundExpiry(interval time.Duration) {
+	d.stopBackgroundExpiry()
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	d.mu.Lock()
+	d.stopExpiry, d.expiryDone = stop, done
+	d.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				d.mu.Lock()
+				evicted := d.removeExpiredLocked(now, nil)
+				d.mu.Unlock()
+				d.notifyEvicted(evicted)
+			}
+		}
+	}()
+}
+
+func (d *Database) stopBackgroundExpiry() {
+	d.mu.Lock()
+	stop, done := d.stopExpiry, d.expiryDone
+	d.stopExpiry, d.expiryDone = nil, nil
+	d.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
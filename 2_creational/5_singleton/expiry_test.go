@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records evictions from the callback, which runs outside the database lock
+type evictionLog struct {
+	mu      sync.Mutex
+	entries []eviction
+}
+
+func (l *evictionLog) record(key, value string, reason EvictionReason) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, eviction{key: key, value: value, reason: reason})
+}
+
+func (l *evictionLog) keys(reason EvictionReason) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var keys []string
+	for _, e := range l.entries {
+		if e.reason == reason {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		want   []string
+	}{
+		// a is read after b and c were added, b has been untouched the longest
+		{"LRU", newLRUPolicy(), []string{"b"}},
+		// a is read twice and c once, b was never read
+		{"LFU", newLFUPolicy(), []string{"b"}},
+		// Reads do not count, a went in first
+		{"FIFO", newFIFOPolicy(), []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDatabase()
+			defer db.Close()
+			if err := db.setEviction(3, tt.policy); err != nil {
+				t.Fatal(err)
+			}
+			var log evictionLog
+			db.setEvictionCallback(log.record)
+
+			db.Set("a", "1")
+			db.Set("b", "2")
+			db.Set("c", "3")
+			db.Get("a")
+			db.Get("c")
+			db.Get("a")
+			db.Set("d", "4")
+
+			if got := log.keys(EvictionCapacity); !slices.Equal(got, tt.want) {
+				t.Errorf("evicted %v, want %v", got, tt.want)
+			}
+			if got := db.Keys(""); len(got) != 3 {
+				t.Errorf("keys = %v, want 3 of them", got)
+			}
+		})
+	}
+}
+
+func TestSetEvictionSeedsExistingKeys(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	for _, key := range []string{"c", "a", "d", "b"} {
+		db.Set(key, key)
+	}
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+
+	if err := db.setEviction(2, newFIFOPolicy()); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.keys(EvictionCapacity); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("evicted %v, want the first keys in sorted order", got)
+	}
+}
+
+func TestSetEvictionUnlimited(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	db.Set("a", "1")
+	db.Set("b", "2")
+
+	if err := db.setEviction(0, newLRUPolicy()); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"c", "d", "e"} {
+		db.Set(key, key)
+	}
+	if got := db.Keys(""); len(got) != 5 {
+		t.Errorf("keys = %v, want all 5 kept", got)
+	}
+}
+
+func TestSetEvictionNilPolicy(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	if err := db.setEviction(3, nil); !errors.Is(err, errNoEvictionPolicy) {
+		t.Errorf("err = %v, want errNoEvictionPolicy", err)
+	}
+}
+
+func TestLazyExpiry(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+
+	db.SetWithTTL("token", "secret", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// Without background expiry the key stays until it is accessed
+	db.mu.RLock()
+	_, stored := db.data["token"]
+	db.mu.RUnlock()
+	if !stored || len(log.keys(EvictionExpired)) != 0 {
+		t.Fatal("expired key removed before it was accessed")
+	}
+
+	if _, ok := db.Get("token"); ok {
+		t.Error("Get returned an expired key")
+	}
+	if got := log.keys(EvictionExpired); !slices.Equal(got, []string{"token"}) {
+		t.Errorf("expired %v, want [token]", got)
+	}
+}
+
+func TestBackgroundExpiry(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+	db.startBackgroundExpiry(time.Millisecond)
+	defer db.stopBackgroundExpiry()
+
+	db.SetWithTTL("token", "secret", time.Millisecond)
+	db.Set("kept", "value")
+
+	deadline := time.Now().Add(time.Second)
+	for len(log.keys(EvictionExpired)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("background expiry did not remove the key")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	db.mu.RLock()
+	_, stored := db.data["token"]
+	db.mu.RUnlock()
+	if stored {
+		t.Error("expired key still stored")
+	}
+	if _, ok := db.Get("kept"); !ok {
+		t.Error("key without a TTL was removed")
+	}
+}
+
+func TestExpiredKeysMakeRoomFirst(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	if err := db.setEviction(2, newLRUPolicy()); err != nil {
+		t.Fatal(err)
+	}
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+
+	db.Set("a", "1")
+	db.SetWithTTL("b", "2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	db.Set("c", "3")
+
+	if got := log.keys(EvictionExpired); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("expired %v, want [b]", got)
+	}
+	if got := log.keys(EvictionCapacity); len(got) != 0 {
+		t.Errorf("evicted live keys %v", got)
+	}
+}
+
+func TestTTLPastLatestDeadline(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set("k", "v")
+	longest := time.Duration(maxExpireSeconds) * time.Second
+
+	if _, err := db.Expire("k", longest); !errors.Is(err, errTTLTooLong) {
+		t.Errorf("Expire err = %v, want errTTLTooLong", err)
+	}
+	if err := db.SetWithTTL("other", "v", longest); !errors.Is(err, errTTLTooLong) {
+		t.Errorf("SetWithTTL err = %v, want errTTLTooLong", err)
+	}
+	// A long TTL that still fits is kept across a reopen
+	if _, err := db.Expire("k", 100*365*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, ok := reopened.Get("k"); !ok {
+		t.Error("k lost after reopening")
+	}
+	if _, ok := reopened.Get("other"); ok {
+		t.Error("rejected SetWithTTL was stored")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "context"
+
+// What consumers of the database depend on, so tests can hand them any implementation
+type Store interface {
+	Get(key string) (string, bool)
+	Set(key, value string) error
+	Delete(key string) (bool, error)
+	Keys(prefix string) []string
+	CompareAndSwap(key, old, new string) (bool, error)
+	SetIfAbsent(key, value string) (bool, error)
+}
+
+// Makes getInstance return store until restore is called. Overrides nest,
+// restore puts back whatever was in place before. The override is process-wide,
+// so tests using it must not run in parallel; parallel tests use withStore.
+func overrideInstance(store Store) (restore func()) {
+	instanceMu.Lock()
+	previous := overridden
+	overridden = store
+	instanceMu.Unlock()
+
+	return func() {
+		instanceMu.Lock()
+		overridden = previous
+		instanceMu.Unlock()
+	}
+}
+
+// Closes the singleton so the next getInstance call opens a fresh one
+func resetInstance() error {
+	instanceMu.Lock()
+	old := instance
+	instance = newInstanceOnce()
+	instanceMu.Unlock()
+
+	if db, ok := old.peek(); ok {
+		return db.Close()
+	}
+	return nil
+}
+
+type storeKey struct{}
+
+// Scopes a store to ctx, which keeps parallel tests isolated from each other
+func withStore(ctx context.Context, store Store) context.Context {
+	return context.WithValue(ctx, storeKey{}, store)
+}
+
+// The store scoped to ctx, or the singleton when there is none
+func storeFrom(ctx context.Context) (Store, error) {
+	if store, ok := ctx.Value(storeKey{}).(Store); ok {
+		return store, nil
+	}
+	return getInstance()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRecordVisitWithStore(t *testing.T) {
+	for _, visits := range []int{1, 10, 200} {
+		t.Run(strconv.Itoa(visits), func(t *testing.T) {
+			t.Parallel()
+			db := newDatabase()
+			defer db.Close()
+			ctx := withStore(context.Background(), db)
+
+			var wg sync.WaitGroup
+			for range visits {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := recordVisit(ctx, "home"); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got, _ := db.Get("visits:home"); got != strconv.Itoa(visits) {
+				t.Errorf("visits = %s, want %d", got, visits)
+			}
+		})
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	t.Parallel()
+	db := newDatabase()
+	defer db.Close()
+
+	if created, err := db.SetIfAbsent("k", "first"); err != nil || !created {
+		t.Fatalf("SetIfAbsent on a missing key = %v, %v", created, err)
+	}
+	if created, err := db.SetIfAbsent("k", "second"); err != nil || created {
+		t.Fatalf("SetIfAbsent on an existing key = %v, %v", created, err)
+	}
+	if got, _ := db.Get("k"); got != "first" {
+		t.Errorf("k = %q, want first", got)
+	}
+}
+
+// Not parallel, the override replaces the singleton for the whole process
+func TestOverrideInstance(t *testing.T) {
+	fake := newDatabase()
+	defer fake.Close()
+	restore := overrideInstance(fake)
+	t.Cleanup(restore)
+
+	if err := recordVisit(context.Background(), "about"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.Get("visits:about"); got != "1" {
+		t.Errorf("visits = %q, want 1", got)
+	}
+
+	inner := newDatabase()
+	defer inner.Close()
+	restoreInner := overrideInstance(inner)
+	if store, _ := getInstance(); store != inner {
+		t.Error("nested override not in place")
+	}
+	restoreInner()
+	if store, _ := getInstance(); store != fake {
+		t.Error("restore did not put back the previous override")
+	}
+}
@@ -1,36 +1,662 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var lock = &sync.Mutex{}
-
+// In-memory key-value store, safe for concurrent use.
+// With a write-ahead log every mutation is logged before it is applied.
 type Database struct {
+	mu            sync.RWMutex
+	data          map[string]string
+	expires       map[string]time.Time
+	maxKeys       int
+	policy        EvictionPolicy
+	onEvict       func(key, value string, reason EvictionReason)
+	stopExpiry    chan struct{}
+	expiryDone    chan struct{}
+	wal           *writeAheadLog
+	snapshotEvery int
+	mutations     int
+	closed        bool
+	// Commit timestamp, bumped once per committed batch of mutations
+	clock     uint64
+	lastWrite map[string]uint64
+	// Superseded versions kept while open transactions may still read them
+	history map[string][]version
+	active  map[*Transaction]struct{}
+}
+
+var errDatabaseClosed = errors.New("database is closed")
+
+func newDatabase() *Database {
+	return &Database{
+		data:      map[string]string{},
+		expires:   map[string]time.Time{},
+		lastWrite: map[string]uint64{},
+		history:   map[string][]version{},
+		active:    map[*Transaction]struct{}{},
+	}
+}
+
+// Database persisted in dir, recovered from its snapshot and log.
+// An empty dir gives a database that lives in memory only.
+func openDatabaseAt(dir string) (*Database, error) {
+	d := newDatabase()
+	if dir == "" {
+		return d, nil
+	}
+	wal, err := openWriteAheadLog(dir, d.applyLocked)
+	if err != nil {
+		return nil, fmt.Errorf("recovering database in %s: %w", dir, err)
+	}
+	d.wal = wal
+	d.snapshotEvery = defaultSnapshotEvery
+	return d, nil
+}
+
+// Applies a logged or recovered mutation to the in-memory state. Callers hold d.mu.
+func (d *Database) applyLocked(rec record) error {
+	switch rec.op {
+	case opSet:
+		d.recordVersionLocked(rec.key, false)
+		_, existed := d.data[rec.key]
+		d.data[rec.key] = rec.value
+		delete(d.expires, rec.key)
+		if d.policy != nil && existed {
+			d.policy.accessed(rec.key)
+		} else if d.policy != nil {
+			d.policy.added(rec.key)
+		}
+	case opDelete:
+		d.recordVersionLocked(rec.key, true)
+		if _, ok := d.data[rec.key]; ok && d.policy != nil {
+			d.policy.removed(rec.key)
+		}
+		delete(d.data, rec.key)
+		delete(d.expires, rec.key)
+	case opExpire:
+		nanos, err := strconv.ParseInt(rec.value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: bad deadline %q", errCorruptRecord, rec.value)
+		}
+		if _, ok := d.data[rec.key]; ok {
+			d.expires[rec.key] = time.Unix(0, nanos)
+		}
+	default:
+		return fmt.Errorf("%w: unknown op %d", errCorruptRecord, rec.op)
+	}
+	return nil
+}
+
+// Logs the mutations, applies them and compacts the log once enough have piled up.
+// Callers hold d.mu.
+func (d *Database) commitLocked(recs ...record) error {
+	if d.closed {
+		return errDatabaseClosed
+	}
+	if d.wal != nil {
+		if err := d.wal.append(recs...); err != nil {
+			return err
+		}
+	}
+	d.clock++
+	for _, rec := range recs {
+		if err := d.applyLocked(rec); err != nil {
+			return err
+		}
+	}
+
+	if d.wal != nil {
+		d.mutations += len(recs)
+		// A failed compaction is retried on the next mutation, the log still has everything
+		if d.snapshotEvery > 0 && d.mutations >= d.snapshotEvery && d.snapshotLocked() == nil {
+			d.mutations = 0
+		}
+	}
+	return nil
+}
+
+func expireRecord(key string, deadline time.Time) record {
+	return record{op: opExpire, key: key, value: strconv.FormatInt(deadline.UnixNano(), 10)}
+}
+
+func (d *Database) snapshotLocked() error {
+	if d.wal == nil {
+		return nil
+	}
+	state := make([]record, 0, len(d.data)+len(d.expires))
+	for key, value := range d.data {
+		state = append(state, record{op: opSet, key: key, value: value})
+	}
+	for key, deadline := range d.expires {
+		state = append(state, expireRecord(key, deadline))
+	}
+	return d.wal.compact(state)
+}
+
+// Writes a snapshot and compacts the log
+func (d *Database) Snapshot() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.snapshotLocked()
 }
 
-var database *Database
+func (d *Database) Close() error {
+	d.stopBackgroundExpiry()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if d.wal == nil {
+		return nil
+	}
+	err := d.wal.close()
+	d.wal = nil
+	return err
+}
+
+func (d *Database) Get(key string) (string, bool) {
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.expiredLocked(key, time.Now()) {
+		evicted = d.removeLocked(key, EvictionExpired, evicted)
+		return "", false
+	}
+	value, ok := d.data[key]
+	if ok && d.policy != nil {
+		d.policy.accessed(key)
+	}
+	return value, ok
+}
+
+// Sets the key and clears any TTL it had
+func (d *Database) Set(key, value string) error {
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	evicted = d.makeRoomLocked(key, evicted)
+	return d.commitLocked(record{op: opSet, key: key, value: value})
+}
+
+// Reports whether the key existed
+func (d *Database) Delete(key string) (bool, error) {
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.expiredLocked(key, time.Now()) {
+		evicted = d.removeLocked(key, EvictionExpired, evicted)
+		return false, nil
+	}
+	if _, ok := d.data[key]; !ok {
+		return false, nil
+	}
+	if err := d.commitLocked(record{op: opDelete, key: key}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-func getInstance() *Database {
-	if database == nil {
-		lock.Lock()
-		defer lock.Unlock()
-		if database == nil {
-			fmt.Println("Creating a single database")
-			database = &Database{}
-		} else {
-			fmt.Println("Database has already been created")
+// Sorted keys starting with prefix, every key for an empty prefix
+func (d *Database) Keys(prefix string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := time.Now()
+	var keys []string
+	for key := range d.data {
+		if strings.HasPrefix(key, prefix) && !d.expiredLocked(key, now) {
+			keys = append(keys, key)
 		}
-	} else {
-		fmt.Println("Database has already been created")
 	}
-	return database
+	slices.Sort(keys)
+	return keys
+}
 
+// Sets the key to new only if it currently holds old
+func (d *Database) CompareAndSwap(key, old, new string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expiredLocked(key, time.Now()) {
+		return false, nil
+	}
+	if current, ok := d.data[key]; !ok || current != old {
+		return false, nil
+	}
+	// Keeps the TTL, a swap is an update rather than a new value
+	recs := []record{{op: opSet, key: key, value: new}}
+	if deadline, ok := d.expires[key]; ok {
+		recs = append(recs, expireRecord(key, deadline))
+	}
+	if err := d.commitLocked(recs...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Sets key only when it has no value, reports whether it did
+func (d *Database) SetIfAbsent(key, value string) (bool, error) {
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.expiredLocked(key, time.Now()) {
+		evicted = d.removeLocked(key, EvictionExpired, evicted)
+	}
+	if _, ok := d.data[key]; ok {
+		return false, nil
+	}
+	evicted = d.makeRoomLocked(key, evicted)
+	if err := d.commitLocked(record{op: opSet, key: key, value: value}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func newInstanceOnce() *retryOnce[*Database] {
+	return &retryOnce[*Database]{
+		init:       openDatabase,
+		attempts:   3,
+		backoff:    10 * time.Millisecond,
+		maxBackoff: time.Second,
+	}
+}
+
+var (
+	// Guards instance and overridden, see resetInstance and overrideInstance
+	instanceMu sync.RWMutex
+	instance   = newInstanceOnce()
+	overridden Store
+)
+
+// Persisted in $DATABASE_DIR when set, recovered on the first getInstance call
+func openDatabase() (*Database, error) {
+	return openDatabaseAt(os.Getenv("DATABASE_DIR"))
+}
+
+func getInstance() (Store, error) {
+	instanceMu.RLock()
+	store, once := overridden, instance
+	instanceMu.RUnlock()
+	if store != nil {
+		return store, nil
+	}
+
+	db, err := once.get()
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
 func main() {
-	for range 5 {
-		getInstance()
+	// Hundreds of goroutines race on the first call, only one creates the database
+	var wg sync.WaitGroup
+	instances := make([]Store, 500)
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i], _ = getInstance()
+		}()
+	}
+	wg.Wait()
+	fmt.Println("Same instance everywhere:", !slices.ContainsFunc(instances, func(db Store) bool {
+		return db != instances[0]
+	}))
+	stats := instanceStats()
+	fmt.Printf("Accesses: %d, waited on initialization: %d, initialized: %v\n", stats.Accesses, stats.Contended, stats.Initialized)
+	// Also served under /debug/vars
+	fmt.Println("Published:", expvar.Get("singletons") != nil)
+
+	// Every goroutine shares the same store
+	db, err := getInstance()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	db.Set("visits", "0")
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, _ := getInstance()
+			for {
+				current, _ := db.Get("visits")
+				n, _ := strconv.Atoi(current)
+				if swapped, _ := db.CompareAndSwap("visits", current, strconv.Itoa(n+1)); swapped {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	db.Set("user:1", "Mario")
+	db.Set("user:2", "Luigi")
+	db.Delete("user:2")
+	visits, _ := db.Get("visits")
+	fmt.Println("Visits:", visits)
+	fmt.Println("Users:", db.Keys("user:"))
+
+	// A failing init is retried instead of cached
+	failures := 4
+	flaky := &retryOnce[*Database]{
+		init: func() (*Database, error) {
+			if failures > 0 {
+				failures--
+				return nil, errors.New("storage not ready")
+			}
+			return newDatabase(), nil
+		},
+		attempts:   3,
+		backoff:    time.Millisecond,
+		maxBackoff: 10 * time.Millisecond,
+	}
+	if _, err := flaky.get(); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := flaky.get(); err == nil {
+		fmt.Println("Initialized on the next call")
+	}
+
+	// State survives a restart, even with a torn final record
+	dir, err := os.MkdirTemp("", "database")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	persisted, err := openDatabaseAt(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	persisted.Set("color", "green")
+	persisted.Snapshot()
+	persisted.Set("shape", "circle")
+	persisted.Delete("color")
+	persisted.Close()
+
+	log, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	torn := encodeRecord(record{op: opSet, key: "half", value: "written"})
+	log.Write(torn[:len(torn)-3])
+	log.Close()
+
+	recovered, err := openDatabaseAt(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer recovered.Close()
+	fmt.Println("Recovered keys:", recovered.Keys(""))
+
+	// Process-wide pool of connections, waiting callers are served in order
+	pool, err := getPool()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			conn, err := pool.Acquire(ctx)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer pool.Release(conn)
+			conn.Set("worker:"+strconv.Itoa(i), strconv.Itoa(conn.id))
+			time.Sleep(10 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	open, idle, waiting := pool.stats()
+	fmt.Printf("Pool open: %d idle: %d waiting: %d workers: %d\n", open, idle, waiting, len(db.Keys("worker:")))
+
+	// Deadlines are honored when the pool is exhausted
+	small, err := newConnectionPool(db, 1, 20*time.Millisecond)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer small.Close()
+	held, _ := small.Acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := small.Acquire(ctx); err != nil {
+		fmt.Println("Acquire:", err)
+	}
+	held.broken = true
+	small.Release(held)
+	replacement, _ := small.Acquire(context.Background())
+	fmt.Println("Broken connection replaced:", replacement.id != held.id)
+	small.Release(replacement)
+	time.Sleep(50 * time.Millisecond)
+	open, idle, _ = small.stats()
+	fmt.Printf("After idle timeout open: %d idle: %d\n", open, idle)
+
+	// One instance per DSN, even when many goroutines race to create it
+	var created atomic.Int32
+	registry := newDatabaseRegistry(func(dsn string) (*Database, error) {
+		created.Add(1)
+		return openDatabaseDSN(dsn)
+	})
+	named := make([]*Database, 200)
+	for i := range named {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			named[i], _ = registry.Get([]string{"mem:sessions", "mem:cache"}[i%2])
+		}()
+	}
+	wg.Wait()
+	fmt.Println("Instances created:", created.Load(), "distinct:", named[0] != named[1])
+	registry.Close("mem:cache")
+	if _, err := registry.Get("mem:cache"); err == nil {
+		fmt.Println("Instances created after reopening:", created.Load())
+	}
+	if err := registry.Close("mem:unknown"); err != nil {
+		fmt.Println(err)
+	}
+	registry.CloseAll()
+
+	named0, _ := getNamedInstance("mem:sessions")
+	named1, _ := getNamedInstance("mem:sessions")
+	fmt.Println("Same named instance:", named0 == named1)
+	databases.CloseAll()
+
+	// A test swaps in its own store and puts the singleton back afterwards
+	restore := overrideInstance(newDatabase())
+	scoped, _ := getInstance()
+	fmt.Println("Overridden:", scoped != db, "keys:", len(scoped.Keys("")))
+	restore()
+	restored, _ := getInstance()
+	fmt.Println("Restored:", restored == db)
+
+	// Parallel tests each carry an isolated store in their context
+	for _, page := range []string{"home", "about", "contact"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			isolated := newDatabase()
+			ctx := withStore(context.Background(), isolated)
+			for range 3 {
+				recordVisit(ctx, page)
+			}
+			fmt.Printf("Isolated store for %s: %v\n", page, isolated.Keys(""))
+		}()
+	}
+	wg.Wait()
+
+	resetInstance()
+	fresh, _ := getInstance()
+	fmt.Println("Fresh after reset:", fresh != db)
+
+	// Process-wide cache with a size limit and expiring keys
+	cache := newDatabase()
+	defer cache.Close()
+	if err := cache.setEviction(3, newLRUPolicy()); err != nil {
+		fmt.Println(err)
+	}
+	cache.setEvictionCallback(func(key, value string, reason EvictionReason) {
+		fmt.Printf("Evicted %s=%s (%s)\n", key, value, reason)
+	})
+	cache.startBackgroundExpiry(5 * time.Millisecond)
+
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	cache.Set("c", "3")
+	cache.Get("a")
+	cache.Set("d", "4")
+	cache.SetWithTTL("token", "secret", 20*time.Millisecond)
+	if ttl, ok := cache.TTL("token"); ok {
+		fmt.Println("Token expires in under:", ttl.Round(10*time.Millisecond))
+	}
+	time.Sleep(50 * time.Millisecond)
+	fmt.Println("Cached keys:", cache.Keys(""))
+
+	// Transactions read a snapshot, a conflicting commit is retried rather than lost
+	bank := newDatabase()
+	defer bank.Close()
+	bank.Set("counter", "0")
+	var conflicts atomic.Int32
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bank.runTransaction(100, func(tx *Transaction) error {
+				current, _ := tx.Get("counter")
+				n, err := strconv.Atoi(current)
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", strconv.Itoa(n+1))
+			})
+			if errors.Is(err, errTxConflict) {
+				conflicts.Add(1)
+			} else if err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+	wg.Wait()
+	counter, _ := bank.Get("counter")
+	fmt.Println("Counter after 50 transactions:", counter, "gave up:", conflicts.Load())
+
+	reader := bank.Begin()
+	bank.Set("counter", "overwritten")
+	seen, _ := reader.Get("counter")
+	fmt.Println("Snapshot still reads:", seen)
+	reader.Set("counter", "stale")
+	if err := reader.Commit(); err != nil {
+		fmt.Println("Commit:", err)
+	}
+
+	// Other local processes reach the singleton over RESP, e.g. redis-cli -p <port>
+	if err := serveDemo(fresh); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func serveDemo(db Store) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	server := newServer(db)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client, err := dialClient(ctx, listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Ping(ctx); err != nil {
+		return err
+	}
+	if err := client.Set(ctx, "remote:greeting", "hello"); err != nil {
+		return err
+	}
+	client.SetWithTTL(ctx, "remote:session", "abc", time.Minute)
+	greeting, _, _ := client.Get(ctx, "remote:greeting")
+	local, _ := db.Get("remote:greeting")
+	fmt.Println("Remote and local see the same value:", greeting == local)
+	keys, _ := client.Keys(ctx, "remote:*")
+	fmt.Println("Remote keys:", keys)
+	exists, _ := client.Expire(ctx, "remote:greeting", time.Hour)
+	deleted, _ := client.Delete(ctx, "remote:greeting", "remote:session", "remote:missing")
+	fmt.Println("Expire set:", exists, "deleted:", deleted)
+	if _, err := client.do(ctx, "FLUSHALL"); err != nil {
+		fmt.Println("Server replied:", err)
+	}
+
+	// Shutdown closes the idle connection and stops accepting new ones
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	fmt.Println("Serve returned:", <-served)
+	if err := client.Ping(ctx); err != nil {
+		fmt.Println("Ping after shutdown failed")
+	}
+	return nil
+}
+
+// Consumer depending on the Store interface rather than the global
+func recordVisit(ctx context.Context, page string) error {
+	store, err := storeFrom(ctx)
+	if err != nil {
+		return err
+	}
+	key := "visits:" + page
+	for {
+		current, ok := store.Get(key)
+		if !ok {
+			// Another visit may create the key first, then this one retries as an increment
+			created, err := store.SetIfAbsent(key, "1")
+			if err != nil || created {
+				return err
+			}
+			continue
+		}
+		n, _ := strconv.Atoi(current)
+		swapped, err := store.CompareAndSwap(key, current, strconv.Itoa(n+1))
+		if err != nil || swapped {
+			return err
+		}
 	}
 }
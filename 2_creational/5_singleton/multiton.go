@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errUnknownDatabase = errors.New("unknown database")
+
+// Opens the database a DSN points at: "mem:<name>" lives in memory,
+// "file:<dir>" is persisted in dir
+func openDatabaseDSN(dsn string) (*Database, error) {
+	scheme, rest, ok := strings.Cut(dsn, ":")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("invalid DSN %q", dsn)
+	}
+	switch scheme {
+	case "mem":
+		return newDatabase(), nil
+	case "file":
+		return openDatabaseAt(rest)
+	}
+	return nil, fmt.Errorf("unsupported DSN scheme %q", scheme)
+}
+
+// Multiton: one lazily created Database per DSN
+type DatabaseRegistry struct {
+	mu        sync.Mutex
+	open      func(dsn string) (*Database, error)
+	instances map[string]*retryOnce[*Database]
+	// DSNs whose instance is being closed, closed channels once it is.
+	// Get waits on them so a file: DSN never has two instances on its directory.
+	closing map[string]chan struct{}
+}
+
+func newDatabaseRegistry(open func(dsn string) (*Database, error)) *DatabaseRegistry {
+	return &DatabaseRegistry{
+		open:      open,
+		instances: map[string]*retryOnce[*Database]{},
+		closing:   map[string]chan struct{}{},
+	}
+}
+
+// Callers racing on the same DSN share one initialization and get the same instance
+func (r *DatabaseRegistry) Get(dsn string) (*Database, error) {
+	r.mu.Lock()
+	for {
+		closed, ok := r.closing[dsn]
+		if !ok {
+			break
+		}
+		r.mu.Unlock()
+		<-closed
+		r.mu.Lock()
+	}
+	once, ok := r.instances[dsn]
+	if !ok {
+		once = &retryOnce[*Database]{
+			init:       func() (*Database, error) { return r.open(dsn) },
+			attempts:   3,
+			backoff:    10 * time.Millisecond,
+			maxBackoff: time.Second,
+		}
+		r.instances[dsn] = once
+	}
+	r.mu.Unlock()
+	return once.get()
+}
+
+// Removes the instance and marks the DSN as closing. Callers hold r.mu.
+func (r *DatabaseRegistry) detachLocked(dsn string) (*retryOnce[*Database], chan struct{}) {
+	once := r.instances[dsn]
+	delete(r.instances, dsn)
+	closed := make(chan struct{})
+	r.closing[dsn] = closed
+	return once, closed
+}
+
+// Closes a detached instance, then lets Get open the DSN again
+func (r *DatabaseRegistry) finishClose(dsn string, once *retryOnce[*Database], closed chan struct{}) error {
+	defer func() {
+		r.mu.Lock()
+		delete(r.closing, dsn)
+		r.mu.Unlock()
+		close(closed)
+	}()
+
+	// Waits for an initialization in flight so its instance is not leaked
+	if db, ok := once.peek(); ok {
+		return db.Close()
+	}
+	return nil
+}
+
+// Closes the instance, the next Get opens a fresh one once it is closed
+func (r *DatabaseRegistry) Close(dsn string) error {
+	r.mu.Lock()
+	if _, ok := r.instances[dsn]; !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %q", errUnknownDatabase, dsn)
+	}
+	once, closed := r.detachLocked(dsn)
+	r.mu.Unlock()
+	return r.finishClose(dsn, once, closed)
+}
+
+func (r *DatabaseRegistry) CloseAll() error {
+	r.mu.Lock()
+	type detached struct {
+		once   *retryOnce[*Database]
+		closed chan struct{}
+	}
+	all := map[string]detached{}
+	for dsn := range r.instances {
+		once, closed := r.detachLocked(dsn)
+		all[dsn] = detached{once, closed}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for dsn, d := range all {
+		if err := r.finishClose(dsn, d.once, d.closed); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dsn, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var databases = newDatabaseRegistry(openDatabaseDSN)
+
+func getNamedInstance(dsn string) (*Database, error) {
+	return databases.Get(dsn)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegistryOneInstancePerDSN(t *testing.T) {
+	var opened atomic.Int32
+	registry := newDatabaseRegistry(func(dsn string) (*Database, error) {
+		opened.Add(1)
+		return openDatabaseDSN(dsn)
+	})
+	defer registry.CloseAll()
+
+	dsns := []string{"mem:sessions", "mem:cache"}
+	results := make([]*Database, 400)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := registry.Get(dsns[i%2])
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = db
+		}()
+	}
+	wg.Wait()
+
+	if got := opened.Load(); got != 2 {
+		t.Errorf("opened %d instances, want 2", got)
+	}
+	for i, db := range results {
+		if db != results[i%2] {
+			t.Fatalf("goroutine %d got a different instance for %s", i, dsns[i%2])
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("different DSNs share an instance")
+	}
+}
+
+func TestRegistryCloseUnknown(t *testing.T) {
+	registry := newDatabaseRegistry(openDatabaseDSN)
+	if err := registry.Close("mem:missing"); !errors.Is(err, errUnknownDatabase) {
+		t.Errorf("err = %v, want errUnknownDatabase", err)
+	}
+}
+
+func TestRegistryNoOverlapWhileClosing(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "db")
+	var (
+		mu   sync.Mutex
+		last *Database
+	)
+	registry := newDatabaseRegistry(func(dsn string) (*Database, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if last != nil {
+			last.mu.RLock()
+			closed := last.closed
+			last.mu.RUnlock()
+			if !closed {
+				t.Error("opened a second instance while the first was still open")
+			}
+		}
+		db, err := openDatabaseDSN(dsn)
+		last = db
+		return db, err
+	})
+	defer registry.CloseAll()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if db, err := registry.Get(dsn); err == nil {
+				db.Set("key", "value")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				registry.Close(dsn)
+			} else {
+				registry.CloseAll()
+			}
+		}()
+	}
+	wg.Wait()
+}
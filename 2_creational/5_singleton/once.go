@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Like sync.Once, but init may fail. A failure is returned rather than cached,
+// so a later call tries again. Each round makes up to attempts tries, doubling the
+// wait between them up to maxBackoff, which defaults to backoff. Calls arriving
+// while a round runs wait for it and share its result, failure included.
+type retryOnce[T any] struct {
+	done  atomic.Bool
+	mu    sync.Mutex
+	value T
+	// Round in progress, nil when none is
+	round      *onceRound[T]
+	init       func() (T, error)
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	// time.Sleep when nil, tests record the waits instead
+	sleep func(time.Duration)
+
+	// Read by Stats without taking mu
+	accesses  atomic.Int64
+	contended atomic.Int64
+	waited    atomic.Int64
+	failures  atomic.Int64
+	createdAt atomic.Int64
+	initTime  atomic.Int64
+}
+
+// One run of attempts, closed done publishes value and err
+type onceRound[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func (o *retryOnce[T]) get() (T, error) {
+	o.accesses.Add(1)
+	// Fast path, the atomic load orders the read of value after its write
+	if o.done.Load() {
+		return o.value, nil
+	}
+
+	o.mu.Lock()
+	if o.done.Load() {
+		o.mu.Unlock()
+		return o.value, nil
+	}
+	if r := o.round; r != nil {
+		o.mu.Unlock()
+		o.contended.Add(1)
+		start := time.Now()
+		<-r.done
+		o.waited.Add(int64(time.Since(start)))
+		return r.value, r.err
+	}
+	r := &onceRound[T]{done: make(chan struct{})}
+	o.round = r
+	o.mu.Unlock()
+
+	r.value, r.err = o.run()
+
+	o.mu.Lock()
+	if r.err == nil {
+		o.value = r.value
+		o.done.Store(true)
+	}
+	o.round = nil
+	o.mu.Unlock()
+	close(r.done)
+	return r.value, r.err
+}
+
+// Runs one round of attempts without holding mu
+func (o *retryOnce[T]) run() (T, error) {
+	attempts := max(o.attempts, 1)
+	wait := o.backoff
+	// Without a cap the wait stays at backoff rather than dropping to zero
+	maxBackoff := o.maxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = o.backoff
+	}
+	sleep := o.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	start := time.Now()
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var value T
+		if value, err = o.init(); err == nil {
+			now := time.Now()
+			o.initTime.Store(int64(now.Sub(start)))
+			o.createdAt.Store(now.UnixNano())
+			return value, nil
+		}
+		o.failures.Add(1)
+		if attempt < attempts {
+			sleep(wait)
+			wait = min(wait*2, maxBackoff)
+		}
+	}
+
+	var zero T
+	return zero, fmt.Errorf("initialization failed after %d attempts: %w", attempts, err)
+}
+
+// Value if initialization succeeded, waiting for a round in progress
+func (o *retryOnce[T]) peek() (T, bool) {
+	o.mu.Lock()
+	r := o.round
+	o.mu.Unlock()
+	if r != nil {
+		<-r.done
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.value, o.done.Load()
+}
+
+// Usage of a lazily initialized singleton
+type InstanceStats struct {
+	Initialized bool      `json:"initialized"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Wall time of the successful get, backoff between failed attempts included
+	InitDuration time.Duration `json:"init_duration_ns"`
+	FailedInits  int64         `json:"failed_inits"`
+	Accesses     int64         `json:"accesses"`
+	// Calls that found a round in progress and waited for its result
+	Contended  int64         `json:"contended"`
+	WaitedTime time.Duration `json:"waited_ns"`
+}
+
+// Never blocks, even while an initialization is running
+func (o *retryOnce[T]) Stats() InstanceStats {
+	stats := InstanceStats{
+		Initialized: o.done.Load(),
+		FailedInits: o.failures.Load(),
+		Accesses:    o.accesses.Load(),
+		Contended:   o.contended.Load(),
+		WaitedTime:  time.Duration(o.waited.Load()),
+	}
+	if stats.Initialized {
+		stats.CreatedAt = time.Unix(0, o.createdAt.Load())
+		stats.InitDuration = time.Duration(o.initTime.Load())
+	}
+	return stats
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryOnceSingleInit(t *testing.T) {
+	var calls atomic.Int32
+	once := &retryOnce[*Database]{
+		init: func() (*Database, error) {
+			calls.Add(1)
+			// Keeps the other goroutines waiting on the lock
+			time.Sleep(10 * time.Millisecond)
+			return newDatabase(), nil
+		},
+		attempts: 1,
+	}
+
+	const goroutines = 500
+	results := make([]*Database, goroutines)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db, err := once.get()
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = db
+		}()
+	}
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("init called %d times, want 1", got)
+	}
+	for i, db := range results {
+		if db == nil || db != results[0] {
+			t.Fatalf("goroutine %d got a different instance", i)
+		}
+	}
+	if stats := once.Stats(); stats.Accesses != goroutines || !stats.Initialized {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestRetryOnceFailureNotCached(t *testing.T) {
+	errDown := errors.New("down")
+	fail := true
+	calls := 0
+	once := &retryOnce[int]{
+		init: func() (int, error) {
+			calls++
+			if fail {
+				return 0, errDown
+			}
+			return 42, nil
+		},
+		attempts: 2,
+		sleep:    func(time.Duration) {},
+	}
+
+	if _, err := once.get(); !errors.Is(err, errDown) {
+		t.Fatalf("err = %v, want errDown", err)
+	}
+	if calls != 2 {
+		t.Errorf("init called %d times, want 2", calls)
+	}
+	if _, ok := once.peek(); ok {
+		t.Error("failed initialization reported as done")
+	}
+
+	fail = false
+	value, err := once.get()
+	if err != nil || value != 42 {
+		t.Fatalf("get = %d, %v, want 42", value, err)
+	}
+	if _, err := once.get(); err != nil || calls != 3 {
+		t.Errorf("init called %d times after success, want 3", calls)
+	}
+	if stats := once.Stats(); stats.FailedInits != 2 {
+		t.Errorf("failed inits = %d, want 2", stats.FailedInits)
+	}
+}
+
+func TestRetryOnceRetrySucceeds(t *testing.T) {
+	calls := 0
+	once := &retryOnce[string]{
+		init: func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", errors.New("not yet")
+			}
+			return "ready", nil
+		},
+		attempts: 5,
+		sleep:    func(time.Duration) {},
+	}
+	if value, err := once.get(); err != nil || value != "ready" {
+		t.Fatalf("get = %q, %v", value, err)
+	}
+	if calls != 3 {
+		t.Errorf("init called %d times, want 3", calls)
+	}
+}
+
+func TestRetryOnceBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackoff time.Duration
+		want       []time.Duration
+	}{
+		{"capped", 35 * time.Millisecond, []time.Duration{10, 20, 35, 35}},
+		{"no cap", 0, []time.Duration{10, 10, 10, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			once := &retryOnce[int]{
+				init:       func() (int, error) { return 0, errors.New("down") },
+				attempts:   5,
+				backoff:    10 * time.Millisecond,
+				maxBackoff: tt.maxBackoff,
+				sleep:      func(d time.Duration) { waits = append(waits, d/time.Millisecond) },
+			}
+			once.get()
+			if !slices.Equal(waits, tt.want) {
+				t.Errorf("waits = %v ms, want %v ms", waits, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryOnceWaitersShareFailedRound(t *testing.T) {
+	errDown := errors.New("down")
+	var calls atomic.Int32
+	release := make(chan struct{})
+	once := &retryOnce[int]{
+		init: func() (int, error) {
+			// The first attempt holds the round open until every goroutine has joined
+			if calls.Add(1) == 1 {
+				<-release
+			}
+			return 0, errDown
+		},
+		attempts: 3,
+		backoff:  10 * time.Millisecond,
+		sleep:    func(time.Duration) {},
+	}
+
+	const goroutines = 50
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := once.get(); !errors.Is(err, errDown) {
+				t.Errorf("err = %v, want errDown", err)
+			}
+		}()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for once.Stats().Contended < goroutines-1 {
+		if time.Now().After(deadline) {
+			t.Fatal("goroutines did not join the round")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 3 {
+		t.Errorf("init called %d times, want one round of 3", got)
+	}
+	if stats := once.Stats(); stats.FailedInits != 3 || stats.Initialized {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// The next call after the round starts a fresh one
+	if _, err := once.get(); !errors.Is(err, errDown) || calls.Load() != 6 {
+		t.Errorf("second round: err = %v, init called %d times, want 6", err, calls.Load())
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var errPoolClosed = errors.New("connection pool is closed")
+
+// In-process stand-in for a network connection to the database
+type Connection struct {
+	id       int
+	db       Store
+	lastUsed time.Time
+	broken   bool
+	closed   bool
+}
+
+func (c *Connection) ping() error {
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+	if c.broken {
+		return fmt.Errorf("connection %d is broken", c.id)
+	}
+	return nil
+}
+
+func (c *Connection) Get(key string) (string, bool) {
+	return c.db.Get(key)
+}
+
+func (c *Connection) Set(key, value string) error {
+	return c.db.Set(key, value)
+}
+
+func (c *Connection) close() {
+	c.closed = true
+}
+
+// Waiting Acquire call. A nil connection grants a free slot to dial into.
+type poolWaiter struct {
+	ch chan *Connection
+}
+
+// Bounded pool of connections handed out first come, first served
+type ConnectionPool struct {
+	mu          sync.Mutex
+	db          Store
+	maxOpen     int
+	open        int
+	nextID      int
+	idle        []*Connection
+	waiters     []*poolWaiter
+	idleTimeout time.Duration
+	closed      bool
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+func newConnectionPool(db Store, maxOpen int, idleTimeout time.Duration) (*ConnectionPool, error) {
+	// Without a slot every Acquire would wait until its ctx ends
+	if maxOpen < 1 {
+		return nil, fmt.Errorf("pool needs room for at least one connection, got %d", maxOpen)
+	}
+	p := &ConnectionPool{
+		db:          db,
+		maxOpen:     maxOpen,
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go p.reapIdle()
+	return p, nil
+}
+
+// Opens a connection in a slot already counted in open. The slot is given back
+// instead when the pool closed after it was taken.
+func (p *ConnectionPool) dial() (*Connection, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.open--
+		return nil, errPoolClosed
+	}
+	p.nextID++
+	return &Connection{id: p.nextID, db: p.db}, nil
+}
+
+// What a waiter received: a connection, or nil for a slot to dial into.
+// Either is given back when the pool closed before the waiter woke up.
+func (p *ConnectionPool) handedOver(conn *Connection) (*Connection, error) {
+	if conn == nil {
+		return p.dial()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.close()
+		p.open--
+		return nil, errPoolClosed
+	}
+	return conn, nil
+}
+
+// Waits for a connection until one is free or ctx is done
+func (p *ConnectionPool) Acquire(ctx context.Context) (*Connection, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		}
+
+		// Queued callers go first, so only take a connection when nobody is waiting
+		if len(p.waiters) == 0 {
+			if n := len(p.idle); n > 0 {
+				conn := p.idle[n-1]
+				p.idle = p.idle[:n-1]
+				p.mu.Unlock()
+				if err := conn.ping(); err != nil {
+					p.discard(conn)
+					continue
+				}
+				return conn, nil
+			}
+			if p.open < p.maxOpen {
+				p.open++
+				p.mu.Unlock()
+				return p.dial()
+			}
+		}
+
+		w := &poolWaiter{ch: make(chan *Connection, 1)}
+		p.waiters = append(p.waiters, w)
+		p.mu.Unlock()
+
+		select {
+		case conn, ok := <-w.ch:
+			if !ok {
+				return nil, errPoolClosed
+			}
+			return p.handedOver(conn)
+		case <-ctx.Done():
+			p.cancelWait(w)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Leaves the queue, passing on anything handed over in the meantime
+func (p *ConnectionPool) cancelWait(w *poolWaiter) {
+	p.mu.Lock()
+	for i, waiter := range p.waiters {
+		if waiter == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			p.mu.Unlock()
+			return
+		}
+	}
+	p.mu.Unlock()
+
+	conn, ok := <-w.ch
+	if !ok {
+		return
+	}
+	if conn == nil {
+		p.mu.Lock()
+		p.releaseSlotLocked()
+		p.mu.Unlock()
+		return
+	}
+	p.Release(conn)
+}
+
+// Returns the connection to the pool, or hands it straight to the longest waiting caller
+func (p *ConnectionPool) Release(conn *Connection) {
+	if conn.ping() != nil {
+		p.discard(conn)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.close()
+		p.open--
+		return
+	}
+	if len(p.waiters) > 0 {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w.ch <- conn
+		return
+	}
+	conn.lastUsed = time.Now()
+	p.idle = append(p.idle, conn)
+}
+
+func (p *ConnectionPool) discard(conn *Connection) {
+	conn.close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseSlotLocked()
+}
+
+// Frees a slot, granting it to the longest waiting caller if there is one
+func (p *ConnectionPool) releaseSlotLocked() {
+	if len(p.waiters) > 0 && !p.closed {
+		w := p.waiters[0]
+		p.waiters = p.waiters[1:]
+		w.ch <- nil
+		return
+	}
+	p.open--
+}
+
+// Closes idle connections past the timeout and those failing their health check
+func (p *ConnectionPool) reapIdle() {
+	defer close(p.done)
+	ticker := time.NewTicker(max(p.idleTimeout/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			kept := p.idle[:0]
+			for _, conn := range p.idle {
+				if now.Sub(conn.lastUsed) >= p.idleTimeout || conn.ping() != nil {
+					conn.close()
+					p.open--
+					continue
+				}
+				kept = append(kept, conn)
+			}
+			p.idle = kept
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *ConnectionPool) stats() (open, idle, waiting int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.open, len(p.idle), len(p.waiters)
+}
+
+// Closes idle connections and fails waiting callers, connections in use close on release
+func (p *ConnectionPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, conn := range p.idle {
+		conn.close()
+		p.open--
+	}
+	p.idle = nil
+	for _, w := range p.waiters {
+		close(w.ch)
+	}
+	p.waiters = nil
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+}
+
+var poolInstance = &retryOnce[*ConnectionPool]{
+	init: func() (*ConnectionPool, error) {
+		db, err := getInstance()
+		if err != nil {
+			return nil, err
+		}
+		return newConnectionPool(db, 4, time.Minute)
+	},
+	attempts:   3,
+	backoff:    10 * time.Millisecond,
+	maxBackoff: time.Second,
+}
+
+// Process-wide pool of connections to the getInstance database
+func getPool() (*ConnectionPool, error) {
+	return poolInstance.get()
+}
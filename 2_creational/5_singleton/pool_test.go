@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, maxOpen int, idleTimeout time.Duration) *ConnectionPool {
+	t.Helper()
+	db := newDatabase()
+	t.Cleanup(func() { db.Close() })
+	pool, err := newConnectionPool(db, maxOpen, idleTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// Polls until cond holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waiting(p *ConnectionPool) int {
+	_, _, n := p.stats()
+	return n
+}
+
+type acquired struct {
+	conn *Connection
+	err  error
+}
+
+// Starts an Acquire and waits until it is queued
+func acquireQueued(t *testing.T, p *ConnectionPool, ctx context.Context) <-chan acquired {
+	t.Helper()
+	before := waiting(p)
+	result := make(chan acquired, 1)
+	go func() {
+		conn, err := p.Acquire(ctx)
+		result <- acquired{conn, err}
+	}()
+	waitFor(t, "the caller to queue", func() bool { return waiting(p) > before })
+	return result
+}
+
+func TestPoolRejectsNoConnections(t *testing.T) {
+	for _, maxOpen := range []int{0, -1} {
+		if _, err := newConnectionPool(newDatabase(), maxOpen, time.Minute); err == nil {
+			t.Errorf("maxOpen %d accepted", maxOpen)
+		}
+	}
+}
+
+func TestPoolFirstComeFirstServed(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	ctx := context.Background()
+	held, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := acquireQueued(t, pool, ctx)
+	second := acquireQueued(t, pool, ctx)
+
+	pool.Release(held)
+	got := <-first
+	if got.err != nil || got.conn != held {
+		t.Fatalf("first waiter got %v, %v, want the released connection", got.conn, got.err)
+	}
+	select {
+	case <-second:
+		t.Fatal("second waiter served before the first released")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	pool.Release(got.conn)
+	if got := <-second; got.err != nil || got.conn != held {
+		t.Fatalf("second waiter got %v, %v", got.conn, got.err)
+	}
+	if open, _, _ := pool.stats(); open != 1 {
+		t.Errorf("open = %d, want 1", open)
+	}
+}
+
+func TestPoolDeadlineWhileExhausted(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	held, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release(held)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := waiting(pool); n != 0 {
+		t.Errorf("%d callers still queued after the deadline", n)
+	}
+}
+
+func TestPoolCancelPassesOnConnection(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	held, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A waiter whose ctx ends just as the connection is handed to it
+	cancelled := &poolWaiter{ch: make(chan *Connection, 1)}
+	pool.mu.Lock()
+	pool.waiters = append(pool.waiters, cancelled)
+	pool.mu.Unlock()
+	next := acquireQueued(t, pool, context.Background())
+
+	pool.Release(held)
+	pool.cancelWait(cancelled)
+
+	if got := <-next; got.err != nil || got.conn != held {
+		t.Fatalf("next waiter got %v, %v, want the connection passed on", got.conn, got.err)
+	}
+	if open, _, _ := pool.stats(); open != 1 {
+		t.Errorf("open = %d, want 1", open)
+	}
+}
+
+func TestPoolCancelPassesOnSlot(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	held, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled := &poolWaiter{ch: make(chan *Connection, 1)}
+	pool.mu.Lock()
+	pool.waiters = append(pool.waiters, cancelled)
+	pool.mu.Unlock()
+	next := acquireQueued(t, pool, context.Background())
+
+	// Discarding the broken connection grants its slot to the cancelled waiter
+	held.broken = true
+	pool.Release(held)
+	pool.cancelWait(cancelled)
+
+	got := <-next
+	if got.err != nil || got.conn == nil || got.conn == held {
+		t.Fatalf("next waiter got %v, %v, want a new connection", got.conn, got.err)
+	}
+	if open, _, _ := pool.stats(); open != 1 {
+		t.Errorf("open = %d, want 1", open)
+	}
+}
+
+func TestPoolReplacesBrokenConnection(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	ctx := context.Background()
+
+	// Broken while in use, discarded on release
+	conn, _ := pool.Acquire(ctx)
+	conn.broken = true
+	pool.Release(conn)
+	if open, idle, _ := pool.stats(); open != 0 || idle != 0 {
+		t.Errorf("open = %d, idle = %d after releasing a broken connection", open, idle)
+	}
+	replacement, err := pool.Acquire(ctx)
+	if err != nil || replacement.id == conn.id {
+		t.Fatalf("got %v, %v, want a new connection", replacement, err)
+	}
+
+	// Broken while idle, found by the health check on Acquire
+	pool.Release(replacement)
+	pool.mu.Lock()
+	replacement.broken = true
+	pool.mu.Unlock()
+	fresh, err := pool.Acquire(ctx)
+	if err != nil || fresh.id == replacement.id {
+		t.Fatalf("got %v, %v, want a new connection", fresh, err)
+	}
+	if !replacement.closed {
+		t.Error("broken connection not closed")
+	}
+	pool.Release(fresh)
+}
+
+func TestPoolReapsIdleConnections(t *testing.T) {
+	pool := newTestPool(t, 2, 5*time.Millisecond)
+	ctx := context.Background()
+	a, _ := pool.Acquire(ctx)
+	b, _ := pool.Acquire(ctx)
+	pool.Release(a)
+	pool.Release(b)
+
+	waitFor(t, "idle connections to be reaped", func() bool {
+		open, idle, _ := pool.stats()
+		return open == 0 && idle == 0
+	})
+	pool.mu.Lock()
+	closed := a.closed && b.closed
+	pool.mu.Unlock()
+	if !closed {
+		t.Error("reaped connections not closed")
+	}
+
+	if conn, err := pool.Acquire(ctx); err != nil || conn.id == a.id || conn.id == b.id {
+		t.Errorf("got %v, %v, want a new connection", conn, err)
+	}
+}
+
+func TestPoolCloseFailsWaiters(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	held, _ := pool.Acquire(context.Background())
+	waiter := acquireQueued(t, pool, context.Background())
+
+	pool.Close()
+	if got := <-waiter; !errors.Is(got.err, errPoolClosed) {
+		t.Errorf("waiter err = %v, want errPoolClosed", got.err)
+	}
+	if _, err := pool.Acquire(context.Background()); !errors.Is(err, errPoolClosed) {
+		t.Errorf("Acquire after Close err = %v, want errPoolClosed", err)
+	}
+
+	// In use connections close on release
+	pool.Release(held)
+	if open, _, _ := pool.stats(); open != 0 || !held.closed {
+		t.Errorf("open = %d, closed = %v after releasing into a closed pool", open, held.closed)
+	}
+}
+
+func TestPoolGrantBeforeClose(t *testing.T) {
+	pool := newTestPool(t, 1, time.Minute)
+	held, _ := pool.Acquire(context.Background())
+
+	// The slot of a discarded connection is granted, then the pool closes
+	// before the waiter wakes up to dial
+	granted := &poolWaiter{ch: make(chan *Connection, 1)}
+	pool.mu.Lock()
+	pool.waiters = append(pool.waiters, granted)
+	pool.mu.Unlock()
+	held.broken = true
+	pool.Release(held)
+	pool.Close()
+
+	if conn, err := pool.handedOver(<-granted.ch); !errors.Is(err, errPoolClosed) {
+		t.Fatalf("got %v, %v, want errPoolClosed", conn, err)
+	}
+	if open, _, _ := pool.stats(); open != 0 {
+		t.Errorf("open = %d, want the slot given back", open)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Subset of the Redis serialization protocol (RESP2) shared by the server and the client
+
+var errProtocol = errors.New("protocol error")
+
+const (
+	// Anything longer is treated as a malformed request rather than allocated
+	maxBulkSize  = 64 << 20
+	maxArraySize = 1 << 20
+	maxLineSize  = 64 << 10
+)
+
+// Error reply sent by the server, e.g. "ERR unknown command"
+type respError string
+
+func (e respError) Error() string {
+	return string(e)
+}
+
+// Line without its CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineSize {
+			return "", fmt.Errorf("%w: line too long", errProtocol)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func readLength(line string, limit int) (int, error) {
+	n, err := strconv.Atoi(line)
+	if err != nil || n < -1 || n > limit {
+		return 0, fmt.Errorf("%w: invalid length %q", errProtocol, line)
+	}
+	return n, nil
+}
+
+func readBulk(r *bufio.Reader, n int) (string, error) {
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return "", fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+	}
+	return string(buf[:n]), nil
+}
+
+// Decodes one value: string for simple and bulk strings, respError, int64,
+// []any for arrays, and nil for the null bulk string and null array
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("%w: empty line", errProtocol)
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return respError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid integer %q", errProtocol, line[1:])
+		}
+		return n, nil
+	case '$':
+		n, err := readLength(line[1:], maxBulkSize)
+		if err != nil || n == -1 {
+			return nil, err
+		}
+		return readBulk(r, n)
+	case '*':
+		n, err := readLength(line[1:], maxArraySize)
+		if err != nil || n == -1 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected type byte %q", errProtocol, line[0])
+}
+
+// Reads a command, either an array of bulk strings as clients send it
+// or an inline command typed by hand, e.g. into telnet
+func readCommand(r *bufio.Reader) ([]string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(line), nil
+	}
+
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := readLength(line[1:], maxArraySize)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected bulk string, got %q", errProtocol, line)
+		}
+		size, err := readLength(line[1:], maxBulkSize)
+		if err != nil {
+			return nil, err
+		}
+		if size == -1 {
+			return nil, fmt.Errorf("%w: null argument", errProtocol)
+		}
+		arg, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// Buffered encoder, replies are sent on flush
+type respWriter struct {
+	*bufio.Writer
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{Writer: bufio.NewWriter(w)}
+}
+
+func (w *respWriter) writeSimple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func (w *respWriter) writeError(msg string) {
+	// A newline would end the reply early
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+func (w *respWriter) writeInteger(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *respWriter) writeBulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *respWriter) writeNull() {
+	w.WriteString("$-1\r\n")
+}
+
+func (w *respWriter) writeArray(items []string) {
+	w.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		w.writeBulk(item)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errServerClosed = errors.New("server closed")
+
+// Largest EXPIRE that fits in a time.Duration
+const maxExpireSeconds = math.MaxInt64 / int64(time.Second)
+
+// Optional TTL support, a Store need not have it
+type expiringStore interface {
+	SetWithTTL(key, value string, ttl time.Duration) error
+	Expire(key string, ttl time.Duration) (bool, error)
+}
+
+// Serves a Store over TCP to anything speaking RESP, redis-cli included.
+// Supports PING, GET, SET, DEL, EXPIRE and KEYS.
+type Server struct {
+	store     Store
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closing   bool
+	wg        sync.WaitGroup
+}
+
+func newServer(store Store) *Server {
+	return &Server{
+		store:     store,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+	}
+}
+
+// Listens on a local address, e.g. "127.0.0.1:6380"
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Accepts connections until Shutdown, then returns errServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		l.Close()
+		return errServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closing {
+				return errServerClosed
+			}
+			l.Close()
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	writer := newRESPWriter(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				writer.writeError("ERR " + err.Error())
+				writer.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		s.execute(writer, args)
+		// Pipelined commands already buffered are answered in one write
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+		if s.shuttingDown() {
+			writer.Flush()
+			return
+		}
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) execute(w *respWriter, args []string) {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	wrongArgs := func() {
+		w.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+
+	switch name {
+	case "PING":
+		switch len(args) {
+		case 0:
+			w.writeSimple("PONG")
+		case 1:
+			w.writeBulk(args[0])
+		default:
+			wrongArgs()
+		}
+
+	case "GET":
+		if len(args) != 1 {
+			wrongArgs()
+			return
+		}
+		if value, ok := s.store.Get(args[0]); ok {
+			w.writeBulk(value)
+		} else {
+			w.writeNull()
+		}
+
+	case "SET":
+		// SET key value [EX seconds | PX milliseconds]
+		if len(args) != 2 && len(args) != 4 {
+			wrongArgs()
+			return
+		}
+		key, value := args[0], args[1]
+		if len(args) == 2 {
+			if err := s.store.Set(key, value); err != nil {
+				w.writeError("ERR " + err.Error())
+				return
+			}
+			w.writeSimple("OK")
+			return
+		}
+		unit := time.Second
+		switch strings.ToUpper(args[2]) {
+		case "EX":
+		case "PX":
+			unit = time.Millisecond
+		default:
+			w.writeError("ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+			w.writeError("ERR invalid expire time in 'set' command")
+			return
+		}
+		store, ok := s.store.(expiringStore)
+		if !ok {
+			w.writeError("ERR expiry is not supported by this store")
+			return
+		}
+		err = store.SetWithTTL(key, value, time.Duration(n)*unit)
+		if errors.Is(err, errTTLTooLong) {
+			w.writeError("ERR invalid expire time in 'set' command")
+			return
+		}
+		if err != nil {
+			w.writeError("ERR " + err.Error())
+			return
+		}
+		w.writeSimple("OK")
+
+	case "DEL":
+		if len(args) == 0 {
+			wrongArgs()
+			return
+		}
+		var deleted int64
+		for _, key := range args {
+			existed, err := s.store.Delete(key)
+			if err != nil {
+				w.writeError("ERR " + err.Error())
+				return
+			}
+			if existed {
+				deleted++
+			}
+		}
+		w.writeInteger(deleted)
+
+	case "EXPIRE":
+		if len(args) != 2 {
+			wrongArgs()
+			return
+		}
+		seconds, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		// The TTL would overflow a time.Duration
+		if seconds > maxExpireSeconds || seconds < -maxExpireSeconds {
+			w.writeError("ERR invalid expire time in 'expire' command")
+			return
+		}
+		store, ok := s.store.(expiringStore)
+		if !ok {
+			w.writeError("ERR expiry is not supported by this store")
+			return
+		}
+		// A TTL of zero or less deletes the key, as in Redis
+		exists, err := store.Expire(args[0], time.Duration(seconds)*time.Second)
+		if errors.Is(err, errTTLTooLong) {
+			w.writeError("ERR invalid expire time in 'expire' command")
+			return
+		}
+		if err != nil {
+			w.writeError("ERR " + err.Error())
+			return
+		}
+		if exists {
+			w.writeInteger(1)
+		} else {
+			w.writeInteger(0)
+		}
+
+	case "KEYS":
+		if len(args) != 1 {
+			wrongArgs()
+			return
+		}
+		prefix, match := compileGlob(args[0])
+		var keys []string
+		for _, key := range s.store.Keys(prefix) {
+			if match(key) {
+				keys = append(keys, key)
+			}
+		}
+		w.writeArray(keys)
+
+	default:
+		w.writeError(fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(name)))
+	}
+}
+
+// Glob pattern as KEYS takes it: * and ? wildcards, [abc] and [^a-z] classes
+// and \ escapes. Returns the literal prefix, so only matching keys are listed.
+func compileGlob(pattern string) (prefix string, match func(string) bool) {
+	var expr, literal strings.Builder
+	inPrefix := true
+	expr.WriteString(`(?s)\A`)
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*':
+			expr.WriteString(".*")
+		case c == '?':
+			expr.WriteString(".")
+		case c == '[' && strings.IndexByte(pattern[i+1:], ']') > 0:
+			end := i + 1 + strings.IndexByte(pattern[i+1:], ']')
+			class := pattern[i+1 : end]
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			if c == '\\' && i+1 < len(pattern) {
+				i++
+				c = pattern[i]
+			}
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			if inPrefix {
+				literal.WriteByte(c)
+			}
+			continue
+		}
+		inPrefix = false
+	}
+	expr.WriteString(`\z`)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		// A class the regexp syntax rejects, e.g. [z-a], matches nothing
+		return literal.String(), func(string) bool { return false }
+	}
+	return literal.String(), re.MatchString
+}
+
+// Stops accepting connections and waits for each to finish the command it is
+// running. Idle connections are closed right away. When ctx ends first, the
+// remaining connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	// Unblocks connections waiting for their next command
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
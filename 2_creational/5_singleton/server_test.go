@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Server over a fresh database on a local port, shut down when the test ends
+func startServer(t *testing.T) (*Database, *Server, string) {
+	t.Helper()
+	db := newDatabase()
+	t.Cleanup(func() { db.Close() })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(db)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		server.Shutdown(context.Background())
+		if err := <-served; !errors.Is(err, errServerClosed) {
+			t.Errorf("Serve returned %v, want errServerClosed", err)
+		}
+	})
+	return db, server, listener.Addr().String()
+}
+
+func dialTestClient(t *testing.T, addr string) *Client {
+	t.Helper()
+	client, err := dialClient(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestServerCommands(t *testing.T) {
+	db, _, addr := startServer(t)
+	client := dialTestClient(t, addr)
+	ctx := context.Background()
+
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("PING: %v", err)
+	}
+	if value, err := client.do(ctx, "PING", "hello"); err != nil || value != "hello" {
+		t.Errorf("PING hello = %v, %v", value, err)
+	}
+
+	if err := client.Set(ctx, "greeting", "hello"); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	if value, ok, err := client.Get(ctx, "greeting"); err != nil || !ok || value != "hello" {
+		t.Errorf("GET greeting = %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := client.Get(ctx, "missing"); err != nil || ok {
+		t.Errorf("GET missing = %v, %v, want a null reply", ok, err)
+	}
+
+	if err := client.SetWithTTL(ctx, "session", "abc", time.Minute); err != nil {
+		t.Fatalf("SET PX: %v", err)
+	}
+	if ttl, ok := db.TTL("session"); !ok || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("session TTL = %v, %v", ttl, ok)
+	}
+	if _, err := client.do(ctx, "SET", "session", "abc", "EX", "60"); err != nil {
+		t.Errorf("SET EX: %v", err)
+	}
+
+	if keys, err := client.Keys(ctx, "*"); err != nil || !slices.Equal(keys, []string{"greeting", "session"}) {
+		t.Errorf("KEYS * = %v, %v", keys, err)
+	}
+
+	if exists, err := client.Expire(ctx, "greeting", time.Hour); err != nil || !exists {
+		t.Errorf("EXPIRE greeting = %v, %v", exists, err)
+	}
+	if exists, err := client.Expire(ctx, "missing", time.Hour); err != nil || exists {
+		t.Errorf("EXPIRE missing = %v, %v", exists, err)
+	}
+
+	if n, err := client.Delete(ctx, "greeting", "session", "missing"); err != nil || n != 2 {
+		t.Errorf("DEL = %d, %v, want 2", n, err)
+	}
+	if keys := db.Keys(""); len(keys) != 0 {
+		t.Errorf("keys left after DEL: %v", keys)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	_, _, addr := startServer(t)
+	client := dialTestClient(t, addr)
+	ctx := context.Background()
+	tooLong := strconv.FormatInt(maxExpireSeconds+1, 10)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"FLUSHALL"}, "ERR unknown command 'flushall'"},
+		{[]string{"GET"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"SET", "k"}, "ERR wrong number of arguments for 'set' command"},
+		{[]string{"SET", "k", "v", "XX", "1"}, "ERR syntax error"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "k", "v", "EX", tooLong}, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "k", "v", "PX", strconv.FormatInt(1<<62, 10)}, "ERR invalid expire time in 'set' command"},
+		{[]string{"DEL"}, "ERR wrong number of arguments for 'del' command"},
+		{[]string{"EXPIRE", "k", "soon"}, "ERR value is not an integer or out of range"},
+		{[]string{"EXPIRE", "k", tooLong}, "ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "k", "-" + tooLong}, "ERR invalid expire time in 'expire' command"},
+		{[]string{"KEYS"}, "ERR wrong number of arguments for 'keys' command"},
+		// Fits a time.Duration, but the deadline is past what the log can store
+		{[]string{"SET", "k", "v", "EX", strconv.FormatInt(maxExpireSeconds, 10)}, "ERR invalid expire time in 'set' command"},
+	}
+	for _, tt := range tests {
+		_, err := client.do(ctx, tt.args...)
+		var reply respError
+		if !errors.As(err, &reply) || string(reply) != tt.want {
+			t.Errorf("%v: err = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+	client.Set(ctx, "k", "v")
+	if _, err := client.do(ctx, "EXPIRE", "k", strconv.FormatInt(maxExpireSeconds, 10)); err == nil || err.Error() != "ERR invalid expire time in 'expire' command" {
+		t.Errorf("EXPIRE past the latest deadline: err = %v", err)
+	}
+	// Error replies leave the connection usable
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("PING after errors: %v", err)
+	}
+}
+
+func TestClientExpireRoundsUp(t *testing.T) {
+	db, _, addr := startServer(t)
+	client := dialTestClient(t, addr)
+	ctx := context.Background()
+	db.Set("k", "v")
+
+	// Truncated to zero seconds this would delete the key
+	if exists, err := client.Expire(ctx, "k", 500*time.Millisecond); err != nil || !exists {
+		t.Fatalf("Expire = %v, %v", exists, err)
+	}
+	if ttl, ok := db.TTL("k"); !ok || ttl <= 500*time.Millisecond || ttl > time.Second {
+		t.Errorf("TTL = %v, %v, want up to a second", ttl, ok)
+	}
+}
+
+func TestServerPipelining(t *testing.T) {
+	_, _, addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Several commands in one write, the replies come back in order
+	requests := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"*2\r\n$3\r\nDEL\r\n$1\r\na\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"*1\r\n$4\r\nPING\r\n"
+	if _, err := conn.Write([]byte(requests)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	for i, want := range []any{"OK", "1", int64(1), nil, "PONG"} {
+		got, err := readValue(reader)
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if got != want {
+			t.Errorf("reply %d = %#v, want %#v", i, got, want)
+		}
+	}
+}
+
+func TestServerProtocolError(t *testing.T) {
+	_, _, addr := startServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("*1\r\n$-5\r\n"))
+	got, err := readValue(bufio.NewReader(conn))
+	if reply, ok := got.(respError); err != nil || !ok || !strings.HasPrefix(string(reply), "ERR protocol error") {
+		t.Errorf("reply = %#v, %v, want a protocol error", got, err)
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		prefix  string
+		match   []string
+		noMatch []string
+	}{
+		{"*", "", []string{"", "anything"}, nil},
+		{"user:*", "user:", []string{"user:", "user:42"}, []string{"users", "admin:user:1"}},
+		{"h?llo", "h", []string{"hello", "hallo"}, []string{"hllo", "heello"}},
+		{"h[ae]llo", "h", []string{"hello", "hallo"}, []string{"hillo"}},
+		{"h[^e]llo", "h", []string{"hallo"}, []string{"hello"}},
+		{"key[0-9]", "key", []string{"key7"}, []string{"keyx", "key10"}},
+		{`a\*b`, "a*b", []string{"a*b"}, []string{"axb"}},
+		{"a.b", "a.b", []string{"a.b"}, []string{"axb"}},
+		{"line*", "line", []string{"line\nbreak"}, nil},
+		{"[z-a]", "", nil, []string{"a", "z"}},
+		{"[unclosed", "[unclosed", []string{"[unclosed"}, []string{"u"}},
+	}
+	for _, tt := range tests {
+		prefix, match := compileGlob(tt.pattern)
+		if prefix != tt.prefix {
+			t.Errorf("%q: prefix = %q, want %q", tt.pattern, prefix, tt.prefix)
+		}
+		for _, key := range tt.match {
+			if !match(key) {
+				t.Errorf("%q does not match %q", tt.pattern, key)
+			}
+		}
+		for _, key := range tt.noMatch {
+			if match(key) {
+				t.Errorf("%q matches %q", tt.pattern, key)
+			}
+		}
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(db)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := dialClient(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The idle connection is closed rather than waited for
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-served; !errors.Is(err, errServerClosed) {
+		t.Errorf("Serve returned %v, want errServerClosed", err)
+	}
+	if err := client.Ping(ctx); err == nil {
+		t.Error("PING succeeded after shutdown")
+	}
+	if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("still accepting connections after shutdown")
+	}
+
+	// A shut down server does not serve again
+	another, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(another); !errors.Is(err, errServerClosed) {
+		t.Errorf("Serve after Shutdown = %v, want errServerClosed", err)
+	}
+}
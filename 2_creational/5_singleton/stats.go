@@ -0,0 +1,26 @@
+package main
+
+import "expvar"
+
+// Stats of the getInstance database since the last resetInstance.
+// Calls answered by an override are not counted.
+func instanceStats() InstanceStats {
+	instanceMu.RLock()
+	once := instance
+	instanceMu.RUnlock()
+	return once.Stats()
+}
+
+func poolStats() InstanceStats {
+	return poolInstance.Stats()
+}
+
+// Served as JSON under /debug/vars by any HTTP server using http.DefaultServeMux
+func init() {
+	expvar.Publish("singletons", expvar.Func(func() any {
+		return map[string]InstanceStats{
+			"database": instanceStats(),
+			"pool":     poolStats(),
+		}
+	}))
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// Retriable, the transaction lost a race with a concurrent commit
+	errTxConflict = errors.New("transaction conflict")
+	errTxDone     = errors.New("transaction already committed or rolled back")
+	errTxTooLarge = errors.New("transaction sets more keys than the database holds")
+)
+
+// Committed value of a key as of a commit timestamp
+type version struct {
+	ts      uint64
+	value   string
+	present bool
+}
+
+// Multi-key transaction with snapshot isolation: reads see the database as it was
+// at Begin, and Commit fails with errTxConflict if another commit wrote one of the
+// same keys in the meantime. Not safe for concurrent use by several goroutines.
+//
+// Every transaction must end with Commit or Rollback: until then the database
+// keeps each value it overwrites for the transaction's snapshot, so one that is
+// abandoned pins that history in memory for good.
+type Transaction struct {
+	db      *Database
+	startTS uint64
+	// Pending writes, nil marks a delete
+	writes map[string]*string
+	done   bool
+}
+
+func (d *Database) Begin() *Transaction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx := &Transaction{
+		db:      d,
+		startTS: d.clock,
+		writes:  map[string]*string{},
+	}
+	d.active[tx] = struct{}{}
+	return tx
+}
+
+// Keeps the value being replaced for open transactions and stamps the write. Callers hold d.mu.
+func (d *Database) recordVersionLocked(key string, deleting bool) {
+	if len(d.active) == 0 {
+		if deleting {
+			delete(d.lastWrite, key)
+		} else {
+			d.lastWrite[key] = d.clock
+		}
+		return
+	}
+	value, ok := d.data[key]
+	d.history[key] = append(d.history[key], version{ts: d.lastWrite[key], value: value, present: ok})
+	d.lastWrite[key] = d.clock
+}
+
+// Value of the key as of ts. Callers hold d.mu.
+func (d *Database) readAtLocked(key string, ts uint64) (string, bool) {
+	if d.lastWrite[key] <= ts {
+		if d.expiredLocked(key, time.Now()) {
+			return "", false
+		}
+		value, ok := d.data[key]
+		return value, ok
+	}
+	versions := d.history[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].ts <= ts {
+			return versions[i].value, versions[i].present
+		}
+	}
+	return "", false
+}
+
+// Drops versions no open transaction can read anymore. Callers hold d.mu.
+func (d *Database) endTxLocked(tx *Transaction) {
+	delete(d.active, tx)
+	if len(d.active) == 0 {
+		d.history = map[string][]version{}
+		for key := range d.lastWrite {
+			if _, ok := d.data[key]; !ok {
+				delete(d.lastWrite, key)
+			}
+		}
+		return
+	}
+
+	oldest := d.clock
+	for open := range d.active {
+		oldest = min(oldest, open.startTS)
+	}
+	for key, versions := range d.history {
+		if d.lastWrite[key] <= oldest {
+			delete(d.history, key)
+			continue
+		}
+		// The newest version at or before the oldest snapshot is the oldest one still visible
+		keep := 0
+		for i, v := range versions {
+			if v.ts <= oldest {
+				keep = i
+			}
+		}
+		d.history[key] = versions[keep:]
+	}
+}
+
+func (tx *Transaction) Get(key string) (string, bool) {
+	if value, ok := tx.writes[key]; ok {
+		if value == nil {
+			return "", false
+		}
+		return *value, true
+	}
+	tx.db.mu.RLock()
+	defer tx.db.mu.RUnlock()
+	return tx.db.readAtLocked(key, tx.startTS)
+}
+
+func (tx *Transaction) Set(key, value string) error {
+	if tx.done {
+		return errTxDone
+	}
+	tx.writes[key] = &value
+	return nil
+}
+
+// Reports whether the key existed in the transaction's view
+func (tx *Transaction) Delete(key string) (bool, error) {
+	if tx.done {
+		return false, errTxDone
+	}
+	_, existed := tx.Get(key)
+	tx.writes[key] = nil
+	return existed, nil
+}
+
+// Applies every write as one logged batch, or none of them on conflict.
+// A crash while the batch is written recovers none of it either.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return errTxDone
+	}
+	tx.done = true
+
+	d := tx.db
+	var evicted []eviction
+	defer func() { d.notifyEvicted(evicted) }()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.endTxLocked(tx)
+
+	for key := range tx.writes {
+		if d.lastWrite[key] > tx.startTS {
+			return fmt.Errorf("%w: %q was written by another commit", errTxConflict, key)
+		}
+	}
+
+	// Every key set ends up in the database, however much else is evicted
+	if d.maxKeys > 0 && d.policy != nil {
+		sets := 0
+		for _, value := range tx.writes {
+			if value != nil {
+				sets++
+			}
+		}
+		if sets > d.maxKeys {
+			return fmt.Errorf("%w: sets %d keys, limit %d", errTxTooLarge, sets, d.maxKeys)
+		}
+	}
+	// Room for every new key at once. Evicting one of the keys being written
+	// changes the count, so it is taken again until nothing more is evicted.
+	for {
+		before := len(d.data)
+		evicted = d.makeRoomForLocked(tx.growthLocked(), evicted)
+		if len(d.data) == before {
+			break
+		}
+	}
+
+	var recs []record
+	for key, value := range tx.writes {
+		if value == nil {
+			if _, ok := d.data[key]; ok {
+				recs = append(recs, record{op: opDelete, key: key})
+			}
+			continue
+		}
+		recs = append(recs, record{op: opSet, key: key, value: *value})
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	return d.commitLocked(recs...)
+}
+
+// How many keys the database gains from the writes: new keys less deleted ones.
+// Callers hold d.mu.
+func (tx *Transaction) growthLocked() int {
+	growth := 0
+	for key, value := range tx.writes {
+		_, exists := tx.db.data[key]
+		switch {
+		case value != nil && !exists:
+			growth++
+		case value == nil && exists:
+			growth--
+		}
+	}
+	return growth
+}
+
+func (tx *Transaction) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.endTxLocked(tx)
+}
+
+// Runs fn in a transaction, retrying from a fresh snapshot on conflict
+func (d *Database) runTransaction(attempts int, fn func(tx *Transaction) error) error {
+	var err error
+	for range max(attempts, 1) {
+		tx := d.Begin()
+		if err = fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); !errors.Is(err, errTxConflict) {
+			return err
+		}
+	}
+	return err
+}
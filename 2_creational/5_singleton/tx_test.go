@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTransactionCounter(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	db.Set("counter", "0")
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		committed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.runTransaction(1000, func(tx *Transaction) error {
+				current, _ := tx.Get("counter")
+				n, err := strconv.Atoi(current)
+				if err != nil {
+					return err
+				}
+				return tx.Set("counter", strconv.Itoa(n+1))
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			committed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := db.Get("counter"); got != strconv.Itoa(committed) {
+		t.Errorf("counter = %s, want %d committed transactions", got, committed)
+	}
+}
+
+func TestTransactionConflict(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	db.Set("k", "0")
+
+	first, second := db.Begin(), db.Begin()
+	first.Set("k", "first")
+	second.Set("k", "second")
+
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(); !errors.Is(err, errTxConflict) {
+		t.Fatalf("err = %v, want errTxConflict", err)
+	}
+	if got, _ := db.Get("k"); got != "first" {
+		t.Errorf("k = %q, want the first commit's value", got)
+	}
+	if err := second.Commit(); !errors.Is(err, errTxDone) {
+		t.Errorf("second Commit err = %v, want errTxDone", err)
+	}
+}
+
+func TestTransactionSnapshot(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	db.Set("k", "before")
+
+	tx := db.Begin()
+	defer tx.Rollback()
+	db.Set("k", "after")
+	db.Delete("k")
+
+	if got, ok := tx.Get("k"); !ok || got != "before" {
+		t.Errorf("snapshot read = %q, %v, want before", got, ok)
+	}
+}
+
+func TestTransactionRespectsCapacity(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	if err := db.setEviction(2, newLRUPolicy()); err != nil {
+		t.Fatal(err)
+	}
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+	db.Set("a", "1")
+
+	db.Set("b", "2")
+
+	tx := db.Begin()
+	tx.Set("c", "3")
+	tx.Set("d", "4")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := db.Keys(""); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("keys = %v, want [c d]", got)
+	}
+	if got := log.keys(EvictionCapacity); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("evicted %v, want [a b]", got)
+	}
+
+	tooLarge := db.Begin()
+	for _, key := range []string{"x", "y", "z"} {
+		tooLarge.Set(key, key)
+	}
+	if err := tooLarge.Commit(); !errors.Is(err, errTxTooLarge) {
+		t.Errorf("err = %v, want errTxTooLarge", err)
+	}
+}
+
+func TestTransactionDeleteMakesRoom(t *testing.T) {
+	db := newDatabase()
+	defer db.Close()
+	if err := db.setEviction(2, newLRUPolicy()); err != nil {
+		t.Fatal(err)
+	}
+	var log evictionLog
+	db.setEvictionCallback(log.record)
+	db.Set("a", "1")
+	db.Set("b", "2")
+
+	tx := db.Begin()
+	tx.Delete("a")
+	tx.Set("c", "3")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := log.keys(EvictionCapacity); len(got) != 0 {
+		t.Errorf("evicted %v, the delete already made room", got)
+	}
+	if _, ok := db.Get("b"); !ok {
+		t.Error("b was evicted")
+	}
+}
+
+func TestTornCommitRecoversNone(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set("from", "100")
+	db.Set("to", "0")
+
+	tx := db.Begin()
+	tx.Set("from", "60")
+	tx.Set("to", "40")
+	tx.Set("audit", "moved 40")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash part way through writing the commit
+	path := filepath.Join(dir, walFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for key, want := range map[string]string{"from": "100", "to": "0"} {
+		if got, _ := reopened.Get(key); got != want {
+			t.Errorf("%s = %q, want %q from before the commit", key, got, want)
+		}
+	}
+	if _, ok := reopened.Get("audit"); ok {
+		t.Error("audit recovered from a torn commit")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.db"
+
+	// Mutations logged before the log is compacted into a snapshot
+	defaultSnapshotEvery = 1000
+)
+
+const (
+	opSet byte = iota + 1
+	opDelete
+	// Value holds the deadline in Unix nanoseconds
+	opExpire
+	// Value holds the encoded records of one append, only ever in the log.
+	// One checksum covers them all, so a torn batch is dropped as a whole.
+	opBatch
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// Record framing shared by the log and the snapshot:
+// payload length and CRC-32 of the payload, then op, key and value
+const recordHeaderSize = 8
+
+// Anything longer is treated as a corrupt length rather than allocated
+const maxRecordSize = 64 << 20
+
+type record struct {
+	op    byte
+	key   string
+	value string
+}
+
+func encodeRecord(r record) []byte {
+	payload := []byte{r.op}
+	payload = binary.AppendUvarint(payload, uint64(len(r.key)))
+	payload = append(payload, r.key...)
+	payload = binary.AppendUvarint(payload, uint64(len(r.value)))
+	payload = append(payload, r.value...)
+
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	return append(buf, payload...)
+}
+
+// Returns io.EOF at a clean end, io.ErrUnexpectedEOF for a torn record
+// and errCorruptRecord when the checksum or layout is wrong. A record failing
+// its checksum still reports its size, so callers can tell where it ends.
+func readRecord(r io.Reader) (record, int, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return record{}, 0, err
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return record{}, 0, errCorruptRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return record{}, 0, err
+	}
+	n := recordHeaderSize + len(payload)
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return record{}, n, errCorruptRecord
+	}
+
+	rec, ok := decodePayload(payload)
+	if !ok {
+		return record{}, n, errCorruptRecord
+	}
+	return rec, n, nil
+}
+
+func decodePayload(payload []byte) (record, bool) {
+	if len(payload) == 0 {
+		return record{}, false
+	}
+	rec := record{op: payload[0]}
+	rest := payload[1:]
+	for _, field := range []*string{&rec.key, &rec.value} {
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || uint64(len(rest)-size) < n {
+			return record{}, false
+		}
+		*field = string(rest[size : size+int(n)])
+		rest = rest[size+int(n):]
+	}
+	return rec, len(rest) == 0
+}
+
+// Several records framed as one, so they are recovered all together or not at all
+func encodeBatch(recs []record) []byte {
+	if len(recs) == 1 {
+		return encodeRecord(recs[0])
+	}
+	var value []byte
+	for _, rec := range recs {
+		value = append(value, encodeRecord(rec)...)
+	}
+	return encodeRecord(record{op: opBatch, value: string(value)})
+}
+
+// Records of a logged batch, or the record itself when it is not one
+func unbatch(rec record) ([]record, error) {
+	if rec.op != opBatch {
+		return []record{rec}, nil
+	}
+	var recs []record
+	reader := strings.NewReader(rec.value)
+	for {
+		inner, _, err := readRecord(reader)
+		if err == io.EOF {
+			return recs, nil
+		}
+		// The batch passed its checksum, so a bad record inside it is not a torn write
+		if err != nil || inner.op == opBatch {
+			return nil, fmt.Errorf("%w: bad record in batch", errCorruptRecord)
+		}
+		recs = append(recs, inner)
+	}
+}
+
+// Append only log of mutations next to the latest snapshot
+type writeAheadLog struct {
+	dir  string
+	file *os.File
+	// End of the last complete append
+	size int64
+}
+
+// Loads the snapshot, replays the log over it and truncates a torn final record.
+// Only the last record may be bad: a corrupt record with data after it is
+// reported as errCorruptRecord and the log is left untouched.
+func openWriteAheadLog(dir string, apply func(record) error) (*writeAheadLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := loadSnapshot(filepath.Join(dir, snapshotFileName), apply); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var good int64
+	reader := bufio.NewReader(file)
+	for {
+		rec, n, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		// A crash mid append leaves a short record, or one failing its checksum,
+		// at the very end. That record never committed and is dropped.
+		tornTail := err == io.ErrUnexpectedEOF ||
+			(errors.Is(err, errCorruptRecord) && n > 0 && good+int64(n) == info.Size())
+		if tornTail {
+			if err := file.Truncate(good); err != nil {
+				file.Close()
+				return nil, err
+			}
+			break
+		}
+		if errors.Is(err, errCorruptRecord) {
+			file.Close()
+			return nil, fmt.Errorf("%s at offset %d: %w", walFileName, good, err)
+		}
+		var recs []record
+		if err == nil {
+			recs, err = unbatch(rec)
+		}
+		for _, rec := range recs {
+			if err = apply(rec); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		good += int64(n)
+	}
+
+	if _, err := file.Seek(good, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &writeAheadLog{dir: dir, file: file, size: good}, nil
+}
+
+// Records are written as one batch, a crash part way leaves a torn tail that
+// recovery drops with every record in it. A failed write is cut back off, so
+// later appends never follow partial bytes.
+func (w *writeAheadLog) append(recs ...record) error {
+	buf := encodeBatch(recs)
+	if _, err := w.file.Write(buf); err != nil {
+		if truncErr := w.file.Truncate(w.size); truncErr != nil {
+			return errors.Join(err, truncErr)
+		}
+		if _, seekErr := w.file.Seek(w.size, io.SeekStart); seekErr != nil {
+			return errors.Join(err, seekErr)
+		}
+		return err
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+// Writes the full state to a new snapshot and empties the log.
+// Replaying an old log over a newer snapshot yields the same state,
+// so a crash between the two steps loses nothing.
+func (w *writeAheadLog) compact(state []record) error {
+	if err := writeSnapshot(filepath.Join(w.dir, snapshotFileName), state); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.size = 0
+	return nil
+}
+
+func (w *writeAheadLog) close() error {
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Snapshots are written to a temporary file and renamed, so they are never torn
+func writeSnapshot(path string, state []record) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), snapshotFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, rec := range state {
+		if _, err := writer.Write(encodeRecord(rec)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func loadSnapshot(path string, apply func(record) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		rec, _, err := readRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = apply(rec)
+		}
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", path, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Replays into a map, deletes included
+func replay(t *testing.T, dir string) (map[string]string, *writeAheadLog, error) {
+	t.Helper()
+	state := map[string]string{}
+	wal, err := openWriteAheadLog(dir, func(rec record) error {
+		switch rec.op {
+		case opSet:
+			state[rec.key] = rec.value
+		case opDelete:
+			delete(state, rec.key)
+		}
+		return nil
+	})
+	if wal != nil {
+		t.Cleanup(func() { wal.close() })
+	}
+	return state, wal, err
+}
+
+func writeRecords(t *testing.T, dir string, recs ...record) {
+	t.Helper()
+	_, wal, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range recs {
+		if err := wal.append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wal.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var threeRecords = []record{
+	{op: opSet, key: "a", value: "1"},
+	{op: opSet, key: "b", value: "2"},
+	{op: opSet, key: "c", value: "3"},
+}
+
+func walSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestWALRecovery(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, append(threeRecords, record{op: opDelete, key: "b"})...)
+
+	state, _, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "c": "3"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, threeRecords...)
+	full := walSize(t, dir)
+	lastStart := full - int64(len(encodeRecord(threeRecords[2])))
+
+	path := filepath.Join(dir, walFileName)
+	if err := os.Truncate(path, full-3); err != nil {
+		t.Fatal(err)
+	}
+	state, wal, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "b": "2"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+	if got := walSize(t, dir); got != lastStart {
+		t.Errorf("log size = %d, want it cut back to %d", got, lastStart)
+	}
+
+	// New appends follow the last good record
+	if err := wal.append(record{op: opSet, key: "d", value: "4"}); err != nil {
+		t.Fatal(err)
+	}
+	wal.close()
+	state, _, err = replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "b": "2", "d": "4"}; !maps.Equal(state, want) {
+		t.Errorf("state after append = %v, want %v", state, want)
+	}
+}
+
+func flipByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWALCorruptFinalRecordDropped(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, threeRecords...)
+	flipByte(t, filepath.Join(dir, walFileName), walSize(t, dir)-1)
+
+	state, _, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "b": "2"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+}
+
+func TestWALCorruptMiddleRecordFails(t *testing.T) {
+	dir := t.TempDir()
+	writeRecords(t, dir, threeRecords...)
+	size := walSize(t, dir)
+	// Inside the payload of the first record
+	flipByte(t, filepath.Join(dir, walFileName), recordHeaderSize+2)
+
+	if _, _, err := replay(t, dir); !errors.Is(err, errCorruptRecord) {
+		t.Fatalf("err = %v, want errCorruptRecord", err)
+	}
+	if got := walSize(t, dir); got != size {
+		t.Errorf("log size = %d, want %d, valid records must not be dropped", got, size)
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	dir := t.TempDir()
+	_, wal, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range threeRecords {
+		wal.append(rec)
+	}
+	if err := wal.compact([]record{{op: opSet, key: "a", value: "1"}, {op: opSet, key: "c", value: "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := walSize(t, dir); got != 0 {
+		t.Errorf("log size after compaction = %d, want 0", got)
+	}
+	if err := wal.append(record{op: opSet, key: "e", value: "5"}); err != nil {
+		t.Fatal(err)
+	}
+	wal.close()
+
+	state, _, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "c": "3", "e": "5"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+}
+
+func TestDatabaseReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set("user:1", "alice")
+	db.Set("user:2", "bob")
+	db.Delete("user:1")
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, ok := reopened.Get("user:1"); ok {
+		t.Error("deleted key recovered")
+	}
+	if value, _ := reopened.Get("user:2"); value != "bob" {
+		t.Errorf("user:2 = %q, want bob", value)
+	}
+}
+
+func TestWALTornBatchDropped(t *testing.T) {
+	dir := t.TempDir()
+	_, wal, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.append(threeRecords[0]); err != nil {
+		t.Fatal(err)
+	}
+	// Both halves of a batch, cut short in the second
+	if err := wal.append(threeRecords[1], threeRecords[2]); err != nil {
+		t.Fatal(err)
+	}
+	wal.close()
+	first := int64(len(encodeRecord(threeRecords[0])))
+	if err := os.Truncate(filepath.Join(dir, walFileName), walSize(t, dir)-3); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want only the record before the batch %v", state, want)
+	}
+	if got := walSize(t, dir); got != first {
+		t.Errorf("log size = %d, want the whole batch cut back to %d", got, first)
+	}
+}
+
+func TestWALBatchRecovered(t *testing.T) {
+	dir := t.TempDir()
+	_, wal, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.append(threeRecords...); err != nil {
+		t.Fatal(err)
+	}
+	wal.close()
+
+	state, _, err := replay(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "b": "2", "c": "3"}; !maps.Equal(state, want) {
+		t.Errorf("state = %v, want %v", state, want)
+	}
+}
+
+func TestDatabaseTornTTLDropped(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set("kept", "value")
+	// The value and its deadline are logged as one batch
+	db.SetWithTTL("tok", "s", time.Hour)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filepath.Join(dir, walFileName), walSize(t, dir)-3); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDatabaseAt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if value, ok := reopened.Get("tok"); ok {
+		t.Errorf("tok = %q recovered without its TTL", value)
+	}
+	if _, ok := reopened.Get("kept"); !ok {
+		t.Error("record before the torn batch lost")
+	}
+}
@@ -1,35 +1,109 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errUnsupportedMedia = errors.New("unsupported media")
+
+// What the client wants published
+type Media struct {
+	path     string
+	mimeType string
+	caption  string
+	// Without the leading #
+	hashtags []string
+	// Description for screen readers, dropped by platforms without support for it
+	altText string
+}
+
+// Where the published post ended up
+type PostResult struct {
+	remoteID string
+	url      string
+}
+
+// Caption followed by the hashtags, as most platforms expect them
+func (m Media) captionWithHashtags() string {
+	parts := []string{}
+	if m.caption != "" {
+		parts = append(parts, m.caption)
+	}
+	for _, tag := range m.hashtags {
+		parts = append(parts, "#"+strings.TrimPrefix(tag, "#"))
+	}
+	return strings.Join(parts, " ")
+}
 
 // Client
 type Publisher struct {
 }
 
-func (p *Publisher) publishContentOnPlatform(platform Platform) {
+func (p *Publisher) publishContentOnPlatform(ctx context.Context, platform Platform, media Media) (PostResult, error) {
 	fmt.Println("Publisher is ready to publish your content.")
-	platform.postMedia()
+	if media.path == "" {
+		return PostResult{}, fmt.Errorf("%w: no file to publish", errUnsupportedMedia)
+	}
+	return platform.PostMedia(ctx, media)
 }
 
 // Client Interface
 type Platform interface {
-	postMedia()
+	PostMedia(ctx context.Context, media Media) (PostResult, error)
 }
 
 // Compatible Service
 type Instagram struct {
+	posts int
+}
+
+const instagramMaxCaption = 2200
+
+func (i *Instagram) PostMedia(ctx context.Context, media Media) (PostResult, error) {
+	if err := ctx.Err(); err != nil {
+		return PostResult{}, err
+	}
+	switch media.mimeType {
+	case "image/jpeg", "image/png", "video/mp4":
+	default:
+		return PostResult{}, fmt.Errorf("%w: Instagram does not accept %q", errUnsupportedMedia, media.mimeType)
+	}
+	caption := media.captionWithHashtags()
+	if len([]rune(caption)) > instagramMaxCaption {
+		return PostResult{}, fmt.Errorf("caption is longer than %d characters", instagramMaxCaption)
+	}
+
+	i.posts++
+	id := fmt.Sprintf("ig%d", i.posts)
+	fmt.Printf("Instagram has published %s: %q (alt: %q)\n", media.path, caption, media.altText)
+	return PostResult{remoteID: id, url: "https://www.instagram.com/p/" + id + "/"}, nil
 }
 
-func (i *Instagram) postMedia() {
-	fmt.Println("Instagram has published your post.")
+// Incompatible Service, with its own upload format and scheduling instead of posting
+type TikTokUpload struct {
+	videoFile   string
+	description string
 }
 
-// Incompatible Service
 type TikTok struct {
+	scheduled int
+}
+
+func (t *TikTok) scheduleMedia(upload TikTokUpload, publishAt time.Time) (int, error) {
+	if !strings.HasSuffix(upload.videoFile, ".mp4") && !strings.HasSuffix(upload.videoFile, ".mov") {
+		return 0, fmt.Errorf("TikTok cannot schedule %s", upload.videoFile)
+	}
+	t.scheduled++
+	fmt.Printf("TikTok is ready to schedule %s at %s: %q\n", upload.videoFile, publishAt.Format(time.Kitchen), upload.description)
+	return t.scheduled, nil
 }
 
-func (t *TikTok) scheduleMedia() {
-	fmt.Println("TikTok is ready to schedule your post.")
+func (t *TikTok) shareLink(scheduleID int) string {
+	return fmt.Sprintf("https://www.tiktok.com/v/%d", scheduleID)
 }
 
 // Adapter
@@ -37,22 +111,60 @@ type TikTokAdapter struct {
 	tikTok *TikTok
 }
 
-func (t *TikTokAdapter) postMedia() {
-	t.tikTok.scheduleMedia()
+func (t *TikTokAdapter) PostMedia(ctx context.Context, media Media) (PostResult, error) {
+	if err := ctx.Err(); err != nil {
+		return PostResult{}, err
+	}
+	// TikTok only takes videos and has no alt text
+	if !strings.HasPrefix(media.mimeType, "video/") {
+		return PostResult{}, fmt.Errorf("%w: TikTok does not accept %q", errUnsupportedMedia, media.mimeType)
+	}
+	upload := TikTokUpload{videoFile: media.path, description: media.captionWithHashtags()}
+	id, err := t.tikTok.scheduleMedia(upload, time.Now())
+	if err != nil {
+		return PostResult{}, err
+	}
 	fmt.Println("Adapter has posted the TikTok content.")
+	return PostResult{remoteID: fmt.Sprint(id), url: t.tikTok.shareLink(id)}, nil
 }
 
 func main() {
-
+	ctx := context.Background()
 	publisher := &Publisher{}
 	instagram := &Instagram{}
 
-	publisher.publishContentOnPlatform(instagram)
+	photo := Media{
+		path:     "beach.jpg",
+		mimeType: "image/jpeg",
+		caption:  "Last day of summer",
+		hashtags: []string{"beach", "sunset"},
+		altText:  "Sun setting over a sandy beach",
+	}
+	if result, err := publisher.publishContentOnPlatform(ctx, instagram, photo); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Posted:", result.remoteID, result.url)
+	}
 
 	tikTok := &TikTok{}
 	tikTokAdapter := &TikTokAdapter{
 		tikTok: tikTok,
 	}
 
-	publisher.publishContentOnPlatform(tikTokAdapter)
+	clip := Media{
+		path:     "waves.mp4",
+		mimeType: "video/mp4",
+		caption:  "Waves",
+		hashtags: []string{"ocean"},
+	}
+	if result, err := publisher.publishContentOnPlatform(ctx, tikTokAdapter, clip); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Posted:", result.remoteID, result.url)
+	}
+
+	// The posting service can tell what went wrong and try elsewhere
+	if _, err := publisher.publishContentOnPlatform(ctx, tikTokAdapter, photo); errors.Is(err, errUnsupportedMedia) {
+		fmt.Println("Skipped:", err)
+	}
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPostMediaResults(t *testing.T) {
+	ctx := context.Background()
+	publisher := &Publisher{}
+	photo := Media{path: "beach.jpg", mimeType: "image/jpeg", caption: "Beach", hashtags: []string{"summer"}}
+	clip := Media{path: "waves.mp4", mimeType: "video/mp4", caption: "Waves"}
+
+	instagram := &Instagram{}
+	tikTok := &TikTokAdapter{tikTok: &TikTok{}}
+	tests := []struct {
+		platform Platform
+		media    Media
+		want     PostResult
+	}{
+		{instagram, photo, PostResult{remoteID: "ig1", url: "https://www.instagram.com/p/ig1/"}},
+		{instagram, clip, PostResult{remoteID: "ig2", url: "https://www.instagram.com/p/ig2/"}},
+		{tikTok, clip, PostResult{remoteID: "1", url: "https://www.tiktok.com/v/1"}},
+	}
+	for _, tt := range tests {
+		got, err := publisher.publishContentOnPlatform(ctx, tt.platform, tt.media)
+		if err != nil {
+			t.Fatalf("%T: %v", tt.platform, err)
+		}
+		if got != tt.want {
+			t.Errorf("%T: result = %+v, want %+v", tt.platform, got, tt.want)
+		}
+	}
+}
+
+func TestPostMediaUnsupportedType(t *testing.T) {
+	tests := []struct {
+		platform Platform
+		mimeType string
+	}{
+		{&Instagram{}, "image/gif"},
+		{&Instagram{}, "video/quicktime"},
+		{&TikTokAdapter{tikTok: &TikTok{}}, "image/jpeg"},
+	}
+	for _, tt := range tests {
+		media := Media{path: "file", mimeType: tt.mimeType}
+		if _, err := tt.platform.PostMedia(context.Background(), media); !errors.Is(err, errUnsupportedMedia) {
+			t.Errorf("%T %s: err = %v, want errUnsupportedMedia", tt.platform, tt.mimeType, err)
+		}
+	}
+
+	// TikTok itself refuses the file, which is not a media type problem
+	tikTok := &TikTok{}
+	_, err := (&TikTokAdapter{tikTok: tikTok}).PostMedia(context.Background(), Media{path: "clip.webm", mimeType: "video/webm"})
+	if err == nil || errors.Is(err, errUnsupportedMedia) {
+		t.Errorf("err = %v, want TikTok's own error", err)
+	}
+	if tikTok.scheduled != 0 {
+		t.Errorf("scheduled %d uploads, want none", tikTok.scheduled)
+	}
+}
+
+func TestInstagramCaptionLimit(t *testing.T) {
+	instagram := &Instagram{}
+	// Counted in characters, not bytes
+	atLimit := Media{path: "a.jpg", mimeType: "image/jpeg", caption: strings.Repeat("é", instagramMaxCaption)}
+	if _, err := instagram.PostMedia(context.Background(), atLimit); err != nil {
+		t.Fatalf("caption at the limit: %v", err)
+	}
+
+	// Hashtags count towards the limit
+	over := atLimit
+	over.caption = strings.Repeat("é", instagramMaxCaption-3)
+	over.hashtags = []string{"ab"}
+	if _, err := instagram.PostMedia(context.Background(), over); err == nil {
+		t.Fatal("caption over the limit accepted")
+	}
+	if instagram.posts != 1 {
+		t.Errorf("posts = %d, want 1", instagram.posts)
+	}
+}
+
+func TestPostMediaCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	publisher := &Publisher{}
+	instagram := &Instagram{}
+	tikTok := &TikTok{}
+	media := Media{path: "waves.mp4", mimeType: "video/mp4"}
+
+	for _, platform := range []Platform{instagram, &TikTokAdapter{tikTok: tikTok}} {
+		if _, err := publisher.publishContentOnPlatform(ctx, platform, media); !errors.Is(err, context.Canceled) {
+			t.Errorf("%T: err = %v, want context.Canceled", platform, err)
+		}
+	}
+	if instagram.posts != 0 || tikTok.scheduled != 0 {
+		t.Error("published after the ctx was cancelled")
+	}
+}
+
+func TestPublishEmptyPath(t *testing.T) {
+	instagram := &Instagram{}
+	_, err := (&Publisher{}).publishContentOnPlatform(context.Background(), instagram, Media{mimeType: "image/jpeg"})
+	if !errors.Is(err, errUnsupportedMedia) {
+		t.Errorf("err = %v, want errUnsupportedMedia", err)
+	}
+	if instagram.posts != 0 {
+		t.Error("platform called without a file")
+	}
+}
+
+func TestCaptionWithHashtags(t *testing.T) {
+	tests := []struct {
+		media Media
+		want  string
+	}{
+		{Media{caption: "Sunset", hashtags: []string{"beach", "#summer"}}, "Sunset #beach #summer"},
+		{Media{hashtags: []string{"only"}}, "#only"},
+		{Media{caption: "Plain"}, "Plain"},
+		{Media{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.media.captionWithHashtags(); got != tt.want {
+			t.Errorf("caption = %q, want %q", got, tt.want)
+		}
+	}
+}
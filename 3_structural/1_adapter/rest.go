@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Classes of HTTP failures, matched with errors.Is against an *HTTPError
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+	errRateLimited  = errors.New("rate limited")
+	errRejected     = errors.New("rejected by platform")
+	errServer       = errors.New("platform server error")
+)
+
+// Non-2xx response from a platform API
+type HTTPError struct {
+	statusCode int
+	// Message the platform gave, or the start of the body
+	message string
+	// Set from Retry-After on 429 and 503 responses
+	retryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("HTTP %d %s", e.statusCode, http.StatusText(e.statusCode))
+	}
+	return fmt.Sprintf("HTTP %d %s: %s", e.statusCode, http.StatusText(e.statusCode), e.message)
+}
+
+func (e *HTTPError) Unwrap() error {
+	switch {
+	case e.statusCode == http.StatusUnauthorized:
+		return errUnauthorized
+	case e.statusCode == http.StatusForbidden:
+		return errForbidden
+	case e.statusCode == http.StatusTooManyRequests:
+		return errRateLimited
+	case e.statusCode == http.StatusUnsupportedMediaType:
+		return errUnsupportedMedia
+	case e.statusCode >= 500:
+		return errServer
+	}
+	return errRejected
+}
+
+// Whether the platform turned the request away without acting on it, so sending
+// it again cannot publish twice. Other 5xx responses may come after the post was
+// made, and an upload is a POST that is not idempotent.
+func (e *HTTPError) temporary() bool {
+	return e.statusCode == http.StatusTooManyRequests || e.statusCode == http.StatusServiceUnavailable
+}
+
+// Publishes, retrying 429 and 503 responses after the wait the platform asks for.
+// Network errors and other failures are not retried, the post may have been made.
+func (p *Publisher) publishWithRetry(ctx context.Context, platform Platform, media Media, attempts int) (PostResult, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := p.publishContentOnPlatform(ctx, platform, media)
+		var httpErr *HTTPError
+		if err == nil || attempt >= attempts || !errors.As(err, &httpErr) || !httpErr.temporary() {
+			return result, err
+		}
+		wait := max(httpErr.retryAfter, 100*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return PostResult{}, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Adapter for platforms with an HTTP API taking multipart uploads.
+// What differs between platforms is configuration.
+type RESTPlatform struct {
+	name     string
+	endpoint string
+	client   *http.Client
+	// Adds credentials to each request
+	authenticate func(req *http.Request)
+	// Form part holding the file
+	fileField string
+	// Form fields sent before the file
+	fields func(media Media) map[string]string
+	// Reads the result from a successful response body
+	decode func(body []byte) (PostResult, error)
+}
+
+func bearerToken(token string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func apiKeyHeader(header, key string) func(req *http.Request) {
+	return func(req *http.Request) {
+		req.Header.Set(header, key)
+	}
+}
+
+// Responses larger than this are cut off rather than read into memory
+const maxResponseSize = 1 << 20
+
+func (p *RESTPlatform) PostMedia(ctx context.Context, media Media) (PostResult, error) {
+	file, err := os.Open(media.path)
+	if err != nil {
+		return PostResult{}, err
+	}
+	defer file.Close()
+
+	// Streams the file instead of buffering the whole upload
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(p.writeForm(form, media, file))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, body)
+	if err != nil {
+		body.Close()
+		return PostResult{}, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	if p.authenticate != nil {
+		p.authenticate(req)
+	}
+
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	// Stops the form writer if the request ended before reading all of it
+	body.Close()
+	if err != nil {
+		return PostResult{}, fmt.Errorf("%s: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return PostResult{}, fmt.Errorf("%s: reading response: %w", p.name, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return PostResult{}, fmt.Errorf("%s: %w", p.name, newHTTPError(resp, respBody))
+	}
+	result, err := p.decode(respBody)
+	if err != nil {
+		return PostResult{}, fmt.Errorf("%s: decoding response: %w", p.name, err)
+	}
+	return result, nil
+}
+
+func (p *RESTPlatform) writeForm(form *multipart.Writer, media Media, file io.Reader) error {
+	if p.fields != nil {
+		for name, value := range p.fields(media) {
+			if err := form.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, p.fileField, filepath.Base(media.path)))
+	header.Set("Content-Type", media.mimeType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{statusCode: resp.StatusCode, message: errorMessage(body)}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		e.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return e
+}
+
+// Understands {"error": {"message": ...}}, {"error": "..."} and {"message": ...},
+// anything else is returned as text
+func errorMessage(body []byte) string {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		var text string
+		switch {
+		case json.Unmarshal(payload.Error, &nested) == nil && nested.Message != "":
+			return nested.Message
+		case json.Unmarshal(payload.Error, &text) == nil && text != "":
+			return text
+		case payload.Message != "":
+			return payload.Message
+		}
+	}
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
+
+// Retry-After holds either seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// Instagram style API: bearer token, caption and alt text fields,
+// and {"id": ..., "permalink": ...} back
+func newInstagramAPI(baseURL, token string, client *http.Client) *RESTPlatform {
+	return &RESTPlatform{
+		name:         "Instagram",
+		endpoint:     strings.TrimSuffix(baseURL, "/") + "/v1/media",
+		client:       client,
+		authenticate: bearerToken(token),
+		fileField:    "file",
+		fields: func(media Media) map[string]string {
+			return map[string]string{
+				"caption":  media.captionWithHashtags(),
+				"alt_text": media.altText,
+			}
+		},
+		decode: func(body []byte) (PostResult, error) {
+			var resp struct {
+				ID        string `json:"id"`
+				Permalink string `json:"permalink"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return PostResult{}, err
+			}
+			if resp.ID == "" {
+				return PostResult{}, errors.New("no media id in response")
+			}
+			return PostResult{remoteID: resp.ID, url: resp.Permalink}, nil
+		},
+	}
+}
+
+// TikTok style API: API key header, no alt text, and the result wrapped in data
+func newTikTokAPI(baseURL, apiKey string, client *http.Client) *RESTPlatform {
+	return &RESTPlatform{
+		name:         "TikTok",
+		endpoint:     strings.TrimSuffix(baseURL, "/") + "/v2/video/upload",
+		client:       client,
+		authenticate: apiKeyHeader("X-Api-Key", apiKey),
+		fileField:    "video",
+		fields: func(media Media) map[string]string {
+			return map[string]string{"description": media.captionWithHashtags()}
+		},
+		decode: func(body []byte) (PostResult, error) {
+			var resp struct {
+				Data struct {
+					VideoID  string `json:"video_id"`
+					ShareURL string `json:"share_url"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return PostResult{}, err
+			}
+			if resp.Data.VideoID == "" {
+				return PostResult{}, errors.New("no video id in response")
+			}
+			return PostResult{remoteID: resp.Data.VideoID, url: resp.Data.ShareURL}, nil
+		},
+	}
+}
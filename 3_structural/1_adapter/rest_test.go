@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Local stand-ins for the platform APIs, so the REST adapters can be exercised offline
+
+// What a stub received, for checking what the adapter sent
+type stubUpload struct {
+	fields   map[string]string
+	filename string
+	mimeType string
+	size     int
+}
+
+type stubPlatform struct {
+	*httptest.Server
+	mu      sync.Mutex
+	uploads []stubUpload
+	// Responses to give before accepting uploads, e.g. a 429 to exercise retries
+	failures []int
+	// Sent with a 429, "0" when empty
+	retryAfter string
+	// Every POST, rejected ones included
+	requests int
+}
+
+func (s *stubPlatform) setRetryAfter(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryAfter = value
+}
+
+func (s *stubPlatform) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *stubPlatform) failNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+func (s *stubPlatform) received() []stubUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubUpload(nil), s.uploads...)
+}
+
+// Counts the request and returns the next queued failure, zero when there is none
+func (s *stubPlatform) nextFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if len(s.failures) == 0 {
+		return 0
+	}
+	code := s.failures[0]
+	s.failures = s.failures[1:]
+	return code
+}
+
+func (s *stubPlatform) retryAfterHeader() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.retryAfter == "" {
+		return "0"
+	}
+	return s.retryAfter
+}
+
+// Reads the multipart upload, the file part named fileField
+func (s *stubPlatform) readUpload(r *http.Request, fileField string) (stubUpload, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return stubUpload{}, err
+	}
+	upload := stubUpload{fields: map[string]string{}}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stubUpload{}, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return stubUpload{}, err
+		}
+		if part.FormName() == fileField {
+			upload.filename = part.FileName()
+			upload.mimeType = part.Header.Get("Content-Type")
+			upload.size = len(data)
+			continue
+		}
+		upload.fields[part.FormName()] = string(data)
+	}
+	if upload.filename == "" {
+		return stubUpload{}, fmt.Errorf("missing %s part", fileField)
+	}
+
+	s.mu.Lock()
+	s.uploads = append(s.uploads, upload)
+	s.mu.Unlock()
+	return upload, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Accepts images and MP4 videos at /v1/media with a bearer token
+func newInstagramStub(token string) *stubPlatform {
+	stub := &stubPlatform{}
+	instagramError := func(w http.ResponseWriter, status int, message string) {
+		writeJSON(w, status, map[string]any{"error": map[string]any{"message": message, "code": status}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/media", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			instagramError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			instagramError(w, http.StatusUnauthorized, "Invalid OAuth access token")
+			return
+		}
+		if code := stub.nextFailure(); code != 0 {
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", stub.retryAfterHeader())
+			}
+			instagramError(w, code, "Please try again later")
+			return
+		}
+		upload, err := stub.readUpload(r, "file")
+		if err != nil {
+			instagramError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !strings.HasPrefix(upload.mimeType, "image/") && upload.mimeType != "video/mp4" {
+			instagramError(w, http.StatusUnsupportedMediaType, "Unsupported media type "+upload.mimeType)
+			return
+		}
+		id := fmt.Sprintf("1789%04d", len(stub.received()))
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"id":        id,
+			"permalink": "https://www.instagram.com/p/" + id + "/",
+		})
+	})
+	stub.Server = httptest.NewServer(mux)
+	return stub
+}
+
+// Accepts videos at /v2/video/upload with an API key header
+func newTikTokStub(apiKey string) *stubPlatform {
+	stub := &stubPlatform{}
+	tikTokError := func(w http.ResponseWriter, status int, message string) {
+		writeJSON(w, status, map[string]any{"error": map[string]any{"code": "error", "message": message}})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/video/upload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			tikTokError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if r.Header.Get("X-Api-Key") != apiKey {
+			tikTokError(w, http.StatusUnauthorized, "access_token_invalid")
+			return
+		}
+		if code := stub.nextFailure(); code != 0 {
+			tikTokError(w, code, "internal_error")
+			return
+		}
+		upload, err := stub.readUpload(r, "video")
+		if err != nil {
+			tikTokError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !strings.HasPrefix(upload.mimeType, "video/") {
+			tikTokError(w, http.StatusUnsupportedMediaType, "only videos can be uploaded")
+			return
+		}
+		id := fmt.Sprintf("7%d", 100+len(stub.received()))
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]string{
+			"video_id":  id,
+			"share_url": "https://www.tiktok.com/@me/video/" + id,
+		}})
+	})
+	stub.Server = httptest.NewServer(mux)
+	return stub
+}
+
+// Writes a small file for media, named after path inside a temporary directory
+func testMedia(t *testing.T, media Media) Media {
+	t.Helper()
+	media.path = filepath.Join(t.TempDir(), media.path)
+	if err := os.WriteFile(media.path, []byte("not really "+media.mimeType), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return media
+}
+
+func TestInstagramAPIUpload(t *testing.T) {
+	stub := newInstagramStub("ig-token")
+	defer stub.Close()
+	api := newInstagramAPI(stub.URL, "ig-token", stub.Client())
+	photo := testMedia(t, Media{path: "beach.jpg", mimeType: "image/jpeg", caption: "Beach", hashtags: []string{"summer"}, altText: "A sandy beach"})
+
+	result, err := (&Publisher{}).publishContentOnPlatform(context.Background(), api, photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.remoteID != "17890001" || result.url != "https://www.instagram.com/p/17890001/" {
+		t.Errorf("result = %+v", result)
+	}
+
+	uploads := stub.received()
+	if len(uploads) != 1 {
+		t.Fatalf("received %d uploads, want 1", len(uploads))
+	}
+	upload := uploads[0]
+	if upload.filename != "beach.jpg" || upload.mimeType != "image/jpeg" || upload.size != len("not really image/jpeg") {
+		t.Errorf("file part = %q %q %d bytes", upload.filename, upload.mimeType, upload.size)
+	}
+	want := map[string]string{"caption": "Beach #summer", "alt_text": "A sandy beach"}
+	if fmt.Sprint(upload.fields) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", upload.fields, want)
+	}
+}
+
+func TestTikTokAPIUpload(t *testing.T) {
+	stub := newTikTokStub("tt-key")
+	defer stub.Close()
+	api := newTikTokAPI(stub.URL, "tt-key", stub.Client())
+	clip := testMedia(t, Media{path: "waves.mp4", mimeType: "video/mp4", caption: "Waves", hashtags: []string{"#ocean"}, altText: "dropped"})
+
+	result, err := (&Publisher{}).publishContentOnPlatform(context.Background(), api, clip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.remoteID != "7101" || result.url != "https://www.tiktok.com/@me/video/7101" {
+		t.Errorf("result = %+v", result)
+	}
+
+	upload := stub.received()[0]
+	if upload.filename != "waves.mp4" || upload.mimeType != "video/mp4" {
+		t.Errorf("file part = %q %q", upload.filename, upload.mimeType)
+	}
+	want := map[string]string{"description": "Waves #ocean"}
+	if fmt.Sprint(upload.fields) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", upload.fields, want)
+	}
+}
+
+func TestRESTAuthentication(t *testing.T) {
+	instagram := newInstagramStub("ig-token")
+	defer instagram.Close()
+	tikTok := newTikTokStub("tt-key")
+	defer tikTok.Close()
+	photo := testMedia(t, Media{path: "beach.jpg", mimeType: "image/jpeg"})
+	clip := testMedia(t, Media{path: "waves.mp4", mimeType: "video/mp4"})
+
+	tests := []struct {
+		name     string
+		platform Platform
+		media    Media
+		message  string
+	}{
+		{"Instagram", newInstagramAPI(instagram.URL, "expired", instagram.Client()), photo, "Invalid OAuth access token"},
+		{"TikTok", newTikTokAPI(tikTok.URL, "wrong", tikTok.Client()), clip, "access_token_invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.platform.PostMedia(context.Background(), tt.media)
+			if !errors.Is(err, errUnauthorized) {
+				t.Fatalf("err = %v, want errUnauthorized", err)
+			}
+			var httpErr *HTTPError
+			if !errors.As(err, &httpErr) || httpErr.statusCode != http.StatusUnauthorized || httpErr.message != tt.message {
+				t.Errorf("HTTPError = %+v, want 401 %q", httpErr, tt.message)
+			}
+		})
+	}
+	if len(instagram.received())+len(tikTok.received()) != 0 {
+		t.Error("an unauthenticated upload was accepted")
+	}
+}
+
+func TestRESTErrorMapping(t *testing.T) {
+	stub := newTikTokStub("tt-key")
+	defer stub.Close()
+	api := newTikTokAPI(stub.URL, "tt-key", stub.Client())
+	clip := testMedia(t, Media{path: "waves.mp4", mimeType: "video/mp4"})
+
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, errRejected},
+		{http.StatusForbidden, errForbidden},
+		{http.StatusTooManyRequests, errRateLimited},
+		{http.StatusInternalServerError, errServer},
+		{http.StatusBadGateway, errServer},
+		{http.StatusServiceUnavailable, errServer},
+	}
+	for _, tt := range tests {
+		stub.failNext(tt.status)
+		_, err := api.PostMedia(context.Background(), clip)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("HTTP %d: err = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+
+	// The platform refuses the file type itself
+	photo := testMedia(t, Media{path: "beach.jpg", mimeType: "image/jpeg"})
+	_, err := api.PostMedia(context.Background(), photo)
+	var httpErr *HTTPError
+	if !errors.Is(err, errUnsupportedMedia) || !errors.As(err, &httpErr) || httpErr.statusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("err = %v, want a 415 errUnsupportedMedia", err)
+	}
+}
+
+func TestPublishWithRetry(t *testing.T) {
+	stub := newInstagramStub("ig-token")
+	defer stub.Close()
+	api := newInstagramAPI(stub.URL, "ig-token", stub.Client())
+	photo := testMedia(t, Media{path: "beach.jpg", mimeType: "image/jpeg"})
+	publisher := &Publisher{}
+	ctx := context.Background()
+
+	t.Run("rate limited then accepted", func(t *testing.T) {
+		before := stub.requestCount()
+		stub.failNext(http.StatusTooManyRequests, http.StatusTooManyRequests)
+		if _, err := publisher.publishWithRetry(ctx, api, photo, 3); err != nil {
+			t.Fatal(err)
+		}
+		if got := stub.requestCount() - before; got != 3 {
+			t.Errorf("%d requests, want 3", got)
+		}
+	})
+
+	t.Run("attempts run out", func(t *testing.T) {
+		before := stub.requestCount()
+		stub.failNext(http.StatusTooManyRequests, http.StatusTooManyRequests)
+		if _, err := publisher.publishWithRetry(ctx, api, photo, 2); !errors.Is(err, errRateLimited) {
+			t.Fatalf("err = %v, want errRateLimited", err)
+		}
+		if got := stub.requestCount() - before; got != 2 {
+			t.Errorf("%d requests, want 2", got)
+		}
+	})
+
+	t.Run("server error not retried", func(t *testing.T) {
+		before, uploads := stub.requestCount(), len(stub.received())
+		stub.failNext(http.StatusInternalServerError)
+		if _, err := publisher.publishWithRetry(ctx, api, photo, 3); !errors.Is(err, errServer) {
+			t.Fatalf("err = %v, want errServer", err)
+		}
+		if got := stub.requestCount() - before; got != 1 || len(stub.received()) != uploads {
+			t.Errorf("%d requests, a 500 may have been published twice", got)
+		}
+	})
+
+	t.Run("context cancelled while waiting", func(t *testing.T) {
+		stub.setRetryAfter("60")
+		defer stub.setRetryAfter("")
+		before := stub.requestCount()
+		stub.failNext(http.StatusTooManyRequests)
+
+		// Cancels once the 429 has been read in full, so the cancel lands in the Retry-After wait
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		transport := stub.Client().Transport
+		client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				resp.Body = &closeHook{ReadCloser: resp.Body, closed: cancel}
+			}
+			return resp, err
+		})}
+		api := newInstagramAPI(stub.URL, "ig-token", client)
+
+		start := time.Now()
+		if _, err := publisher.publishWithRetry(ctx, api, photo, 3); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("returned after %v, the wait was not cut short", elapsed)
+		}
+		if got := stub.requestCount() - before; got != 1 {
+			t.Errorf("%d requests, want only the rate limited one", got)
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Response body calling closed once the client is done with it
+type closeHook struct {
+	io.ReadCloser
+	closed func()
+}
+
+func (c *closeHook) Close() error {
+	err := c.ReadCloser.Close()
+	c.closed()
+	return err
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, want about an hour", future, got)
+	}
+}